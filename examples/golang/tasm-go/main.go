@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"tasm-go/spec"
@@ -10,21 +12,76 @@ import (
 )
 
 func main() {
-	content, err := os.ReadFile("../../../gen/tvm-specification.json")
-	if err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		diff(os.Args[2:])
 		return
 	}
-	tvmSpec, err := spec.UnmarshalSpecification(content)
+
+	tvmSpec := spec.Default()
+
+	bocData, err := os.ReadFile("./testdata/jetton_minter_discoverable_JettonMinter.boc")
 	if err != nil {
-		return
+		fmt.Fprintln(os.Stderr, "failed to read code:", err)
+		os.Exit(1)
 	}
 
-	bocData, err := os.ReadFile("./testdata/jetton_minter_discoverable_JettonMinter.boc")
+	decoder, err := tasm.NewDecoder(tvmSpec)
 	if err != nil {
-		return
+		fmt.Fprintln(os.Stderr, "failed to create decoder:", err)
+		os.Exit(1)
 	}
 
-	codeCell, _ := cell.FromBOC(bocData)
-	code := tasm.DecompileCell(tvmSpec, codeCell)
+	codeCell, err := cell.FromBOC(bocData)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to parse code:", err)
+		os.Exit(1)
+	}
+	code, err := decoder.DecompileCell(codeCell)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to decompile:", err)
+		os.Exit(1)
+	}
 	fmt.Println(code)
 }
+
+// diff prints changes between specifications: `diff [-json] [old.json] new.json`,
+// the embedded specification is the old one by default.
+func diff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "print changes in JSON")
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Fprintln(os.Stderr, "usage: diff [-json] [old.json] new.json")
+		os.Exit(2)
+	}
+
+	oldSpec := spec.Default()
+	paths := flags.Args()
+	if len(paths) == 2 {
+		var err error
+		oldSpec, err = spec.Load(paths[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to load specification:", err)
+			os.Exit(1)
+		}
+		paths = paths[1:]
+	}
+	newSpec, err := spec.Load(paths[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load specification:", err)
+		os.Exit(1)
+	}
+
+	changes := spec.Diff(oldSpec, newSpec)
+	if !*jsonOutput {
+		fmt.Print(changes)
+		return
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(changes); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to encode changes:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+package spec
+
+import (
+	"slices"
+	"strings"
+)
+
+// Loop returns the loop started by the instruction, e.g. WHILE saves it into c0 to be executed
+// after the condition, nil if the instruction isn't a loop. Body of the loop is the `cc` continuation
+// for loops like REPEATEND, which take the rest of the code as the body.
+func Loop(instr *Instruction) *Continuation {
+	if instr.ControlFlow == nil {
+		return nil
+	}
+	for i := range instr.ControlFlow.Branches {
+		for c := &instr.ControlFlow.Branches[i]; c != nil; {
+			if c.Type == PurpleSpecial && c.Name != nil && *c.Name != Pushint {
+				return c
+			}
+			if c.Save == nil {
+				break
+			}
+			c = c.Save.C0
+		}
+	}
+	return nil
+}
+
+// IsConditional reports whether the single branch of the instruction may be not taken, so that
+// the execution continues with the next instruction: IF-like instructions and dictionary lookups,
+// e.g. DICTIGETJMP, which continue if the key is missing.
+func IsConditional(instr *Instruction) bool {
+	if instr.ControlFlow == nil || len(instr.ControlFlow.Branches) != 1 {
+		return false
+	}
+	return strings.HasPrefix(instr.Name, "IF") || instr.Category == "dictionary"
+}
+
+// IsCall reports whether the branch returns to the next instruction, i.e. saves c0.
+func IsCall(branch Continuation) bool {
+	return branch.Save != nil && branch.Save.C0 != nil
+}
+
+// PushesContinuation reports whether the instruction pushes a continuation from its arguments, e.g. PUSHCONT.
+func PushesContinuation(instr *Instruction) bool {
+	if instr.ControlFlow != nil || instr.Signature == nil || instr.Signature.Outputs == nil ||
+		len(instr.Signature.Outputs.Stack) != 1 {
+		return false
+	}
+	return slices.Equal(instr.Signature.Outputs.Stack[0].ValueTypes, []PossibleValueType{PossibleValueTypeContinuation})
+}
+
+// ContinuationInputs returns names of the stack inputs of the instruction which are continuations,
+// the last one is the top of the stack.
+func ContinuationInputs(instr *Instruction) []string {
+	if instr.Signature == nil || instr.Signature.Inputs == nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range instr.Signature.Inputs.Stack {
+		if entry.Type == TypeSimple && entry.Name != nil &&
+			slices.Equal(entry.ValueTypes, []PossibleValueType{PossibleValueTypeContinuation}) {
+			names = append(names, *entry.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,248 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ChangeKind is the kind of Change.
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	// Renamed instructions have the same opcode range, renamed Fift instructions
+	// have the same actual name and arguments
+	Renamed ChangeKind = "renamed"
+	Changed ChangeKind = "changed"
+)
+
+// Change is a difference of an instruction or a Fift instruction between specifications.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	// Fift is set for changes of Fift instructions
+	Fift bool `json:"fift,omitempty"`
+	// Name of the instruction in the new specification, or in the old one if it's removed
+	Name string `json:"name"`
+	// Changed part of the instruction, e.g. `layout.tlb` or `gas`, empty for other kinds
+	Field string `json:"field,omitempty"`
+	// Old and new values of the field, or the old name of renamed instructions
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	name := c.Name
+	if c.Fift {
+		name = "fift " + name
+	}
+	switch c.Kind {
+	case Added:
+		return "+ " + name
+	case Removed:
+		return "- " + name
+	case Renamed:
+		return fmt.Sprintf("~ %s: renamed from %s", name, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %s: `%s` -> `%s`", name, c.Field, c.Old, c.New)
+}
+
+// Changes is the result of Diff.
+type Changes struct {
+	OldVersion string   `json:"old_version"`
+	NewVersion string   `json:"new_version"`
+	Changes    []Change `json:"changes"`
+}
+
+// String formats changes one per line after the versions, e.g. ~ ADD: gas: `[18]` -> `[26]`.
+func (c Changes) String() string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("%s -> %s\n", c.OldVersion, c.NewVersion))
+	for _, change := range c.Changes {
+		builder.WriteString(change.String())
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// Diff compares specifications and returns what the decoder, the assembler and the analyses
+// depend on: added, removed and renamed instructions, changed layouts (opcode ranges, arguments,
+// TLB and versions), signatures, gas, exit codes and effects, and changed Fift instructions.
+// Descriptions and other documentation are not compared. Instructions are matched by name,
+// changes follow the order of the new specification, removals come first.
+func Diff(old, new Specification) Changes {
+	result := Changes{OldVersion: old.Version, NewVersion: new.Version, Changes: []Change{}}
+	add := func(change Change) {
+		result.Changes = append(result.Changes, change)
+	}
+
+	oldByName := make(map[string]*Instruction)
+	for i := range old.Instructions {
+		oldByName[old.Instructions[i].Name] = &old.Instructions[i]
+	}
+	newNames := make(map[string]bool)
+	for _, instr := range new.Instructions {
+		newNames[instr.Name] = true
+	}
+	// Removed instructions with the same opcodes as added ones are renamed
+	removed := make(map[string]*Instruction)
+	for i := range old.Instructions {
+		if instr := &old.Instructions[i]; !newNames[instr.Name] {
+			removed[formatRange(instr.Layout)] = instr
+		}
+	}
+
+	for i := range old.Instructions {
+		instr := &old.Instructions[i]
+		if newNames[instr.Name] {
+			continue
+		}
+		renamed := slices.ContainsFunc(new.Instructions, func(o Instruction) bool {
+			return oldByName[o.Name] == nil && formatRange(o.Layout) == formatRange(instr.Layout)
+		})
+		if !renamed {
+			add(Change{Kind: Removed, Name: instr.Name})
+		}
+	}
+	for i := range new.Instructions {
+		instr := &new.Instructions[i]
+		previous := oldByName[instr.Name]
+		if previous == nil {
+			previous = removed[formatRange(instr.Layout)]
+			if previous == nil {
+				add(Change{Kind: Added, Name: instr.Name})
+				continue
+			}
+			add(Change{Kind: Renamed, Name: instr.Name, Old: previous.Name})
+		}
+		for _, field := range instructionFields {
+			if a, b := field.value(previous), field.value(instr); a != b {
+				add(Change{Kind: Changed, Name: instr.Name, Field: field.name, Old: a, New: b})
+			}
+		}
+		if a, b := compactJSON(previous.Signature), compactJSON(instr.Signature); a != b {
+			// Stack strings are shorter, the structured signature is shown if they are the same
+			if sa, sb := stackString(previous), stackString(instr); sa != sb {
+				a, b = sa, sb
+			}
+			add(Change{Kind: Changed, Name: instr.Name, Field: "signature", Old: a, New: b})
+		}
+	}
+
+	diffFift(old.FiftInstructions, new.FiftInstructions, add)
+	return result
+}
+
+// instructionFields are the compared parts of instructions, formatted for the output.
+// Signatures are compared separately.
+var instructionFields = []struct {
+	name  string
+	value func(*Instruction) string
+}{
+	{"layout.range", func(instr *Instruction) string { return formatRange(instr.Layout) }},
+	{"layout.args", func(instr *Instruction) string { return compactJSON(instr.Layout.Args) }},
+	{"layout.tlb", func(instr *Instruction) string { return instr.Layout.Tlb }},
+	{"layout.version", func(instr *Instruction) string {
+		if instr.Layout.Version == nil {
+			return "none"
+		}
+		return fmt.Sprintf("%d", *instr.Layout.Version)
+	}},
+	{"gas", func(instr *Instruction) string {
+		var values []string
+		for _, entry := range instr.Description.Gas {
+			value := fmt.Sprintf("%d", entry.Value)
+			if entry.Formula != nil {
+				value += " (" + *entry.Formula + ")"
+			}
+			values = append(values, value)
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}},
+	{"exit_codes", func(instr *Instruction) string {
+		var codes []string
+		for _, code := range instr.Description.ExitCodes {
+			if !slices.Contains(codes, code.Errno) {
+				codes = append(codes, code.Errno)
+			}
+		}
+		slices.Sort(codes)
+		return "[" + strings.Join(codes, ", ") + "]"
+	}},
+	{"effects", func(instr *Instruction) string {
+		effects := make([]string, len(instr.Effects))
+		for i, effect := range instr.Effects {
+			effects[i] = string(effect)
+		}
+		slices.Sort(effects)
+		return "[" + strings.Join(effects, ", ") + "]"
+	}},
+}
+
+// formatRange formats the range of opcodes of the layout, e.g. `[A000, A100)`.
+func formatRange(layout Layout) string {
+	return fmt.Sprintf("[%06X, %06X)", layout.Min, layout.Max)
+}
+
+// stackString returns the stack string of the signature, `none` if there is no such.
+func stackString(instr *Instruction) string {
+	if instr.Signature == nil || instr.Signature.StackString == nil {
+		return "none"
+	}
+	return *instr.Signature.StackString
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// diffFift compares Fift instructions by name, a removed alias is renamed if an added one
+// is the same instruction with the same arguments, e.g. when FALSE is renamed to ZERO.
+func diffFift(old, new []FiftInstruction, add func(Change)) {
+	target := func(f FiftInstruction) string {
+		return f.ActualName + " " + compactJSON(f.Arguments)
+	}
+	oldByName := make(map[string]FiftInstruction)
+	for _, f := range old {
+		oldByName[f.Name] = f
+	}
+	newByName := make(map[string]FiftInstruction)
+	for _, f := range new {
+		newByName[f.Name] = f
+	}
+	removed := make(map[string]string)
+	for _, f := range old {
+		if _, ok := newByName[f.Name]; !ok {
+			removed[target(f)] = f.Name
+		}
+	}
+	renamed := make(map[string]bool)
+	var changes []Change
+	for _, f := range new {
+		previous, ok := oldByName[f.Name]
+		switch {
+		case ok && target(previous) != target(f):
+			changes = append(changes, Change{Kind: Changed, Fift: true, Name: f.Name, Field: "actual_name", Old: target(previous), New: target(f)})
+		case ok:
+		case removed[target(f)] != "" && !renamed[removed[target(f)]]:
+			renamed[removed[target(f)]] = true
+			changes = append(changes, Change{Kind: Renamed, Fift: true, Name: f.Name, Old: removed[target(f)]})
+		default:
+			changes = append(changes, Change{Kind: Added, Fift: true, Name: f.Name})
+		}
+	}
+	for _, f := range old {
+		if _, ok := newByName[f.Name]; !ok && !renamed[f.Name] {
+			add(Change{Kind: Removed, Fift: true, Name: f.Name})
+		}
+	}
+	for _, change := range changes {
+		add(change)
+	}
+}
@@ -0,0 +1,62 @@
+package spec
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestDiff checks added, removed, renamed and changed instructions and Fift instructions.
+func TestDiff(t *testing.T) {
+	old, err := UnmarshalSpecification(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(old, old); len(changes.Changes) != 0 {
+		t.Errorf("expected no changes of the same specification, got %v", changes)
+	}
+
+	new, err := UnmarshalSpecification(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	new.Version = "next"
+	for i := range new.Instructions {
+		instr := &new.Instructions[i]
+		switch instr.Name {
+		case "SUB":
+			// Same opcodes under the new name, the changes are compared with the old name
+			instr.Name = "SUBTRACT"
+			instr.Description.Gas[0].Value = 26
+		case "ADD":
+			instr.Description.Gas[0].Value = 26
+			stackString := "x:Int y:Int -> z:Int"
+			instr.Signature.StackString = &stackString
+		}
+	}
+	new.Instructions = slices.DeleteFunc(new.Instructions, func(instr Instruction) bool { return instr.Name == "NEGATE" })
+	new.Instructions = append(new.Instructions, Instruction{Name: "NOP2", Layout: Layout{Min: 0xfff000, Max: 0xfff001}})
+	new.FiftInstructions[0].Name = "ROTREV2"
+	new.FiftInstructions[1].ActualName = "ADD"
+
+	changes := Diff(old, new)
+	expected := []string{
+		"- NEGATE",
+		"~ ADD: gas: `[18]` -> `[26]`",
+		"~ ADD: signature: `x:Int y:Int -> result:Int` -> `x:Int y:Int -> z:Int`",
+		"~ SUBTRACT: renamed from SUB",
+		"~ SUBTRACT: gas: `[18]` -> `[26]`",
+		"+ NOP2",
+		"~ fift ROTREV2: renamed from -ROT",
+		"~ fift -ROLL: actual_name: `BLKSWAP [\"$args[0]\",1]` -> `ADD [\"$args[0]\",1]`",
+	}
+	var actual []string
+	for _, change := range changes.Changes {
+		actual = append(actual, change.String())
+	}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("expected\n%q\ngot\n%q", expected, actual)
+	}
+	if changes.OldVersion != old.Version || changes.NewVersion != "next" {
+		t.Errorf("unexpected versions %s -> %s", changes.OldVersion, changes.NewVersion)
+	}
+}
@@ -0,0 +1,201 @@
+package gas
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFormula is returned by Parse for malformed formulas.
+var ErrInvalidFormula = errors.New("invalid gas formula")
+
+// ErrUnboundVariable is returned by Formula.Eval for variables missing in the environment.
+var ErrUnboundVariable = errors.New("unbound variable")
+
+// Formula is a parsed GasConsumptionEntry.Formula, an integer expression of
+// numbers, variables, parentheses and the + - * / operators, e.g. `11375 + 630 * n + 8820 * n * n`.
+// Division truncates towards zero.
+type Formula struct {
+	text string
+	root *node
+}
+
+// node is an expression: a number, a variable or a binary operation.
+type node struct {
+	op    byte // 0 for leaves, otherwise one of + - * /
+	value int64
+	name  string
+	left  *node
+	right *node
+}
+
+// Parse parses the formula.
+func Parse(text string) (*Formula, error) {
+	p := &formulaParser{text: text}
+	root, err := p.sum()
+	if err == nil && p.skipSpaces() < len(text) {
+		err = fmt.Errorf("unexpected %q", text[p.pos:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %w", ErrInvalidFormula, text, err)
+	}
+	return &Formula{text: text, root: root}, nil
+}
+
+func (f *Formula) String() string {
+	return f.text
+}
+
+// Vars returns sorted names of variables of the formula.
+func (f *Formula) Vars() []string {
+	var names []string
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n.op != 0 {
+			walk(n.left)
+			walk(n.right)
+		} else if n.name != "" && !slices.Contains(names, n.name) {
+			names = append(names, n.name)
+		}
+	}
+	walk(f.root)
+	slices.Sort(names)
+	return names
+}
+
+// Eval evaluates the formula with the values of variables.
+func (f *Formula) Eval(env map[string]int64) (int64, error) {
+	return eval(f.root, env)
+}
+
+func eval(n *node, env map[string]int64) (int64, error) {
+	if n.op == 0 {
+		if n.name == "" {
+			return n.value, nil
+		}
+		v, ok := env[n.name]
+		if !ok {
+			return 0, fmt.Errorf("%w %s", ErrUnboundVariable, n.name)
+		}
+		return v, nil
+	}
+	left, err := eval(n.left, env)
+	if err != nil {
+		return 0, err
+	}
+	right, err := eval(n.right, env)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	default:
+		if right == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return left / right, nil
+	}
+}
+
+// formulaParser is a recursive descent parser:
+//
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | number | name | "(" sum ")"
+type formulaParser struct {
+	text string
+	pos  int
+}
+
+func (p *formulaParser) skipSpaces() int {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t') {
+		p.pos++
+	}
+	return p.pos
+}
+
+// operator consumes one of the operators if it's next.
+func (p *formulaParser) operator(ops string) byte {
+	if p.skipSpaces() < len(p.text) && strings.IndexByte(ops, p.text[p.pos]) >= 0 {
+		p.pos++
+		return p.text[p.pos-1]
+	}
+	return 0
+}
+
+func (p *formulaParser) sum() (*node, error) {
+	return p.binary("+-", p.product)
+}
+
+func (p *formulaParser) product() (*node, error) {
+	return p.binary("*/", p.unary)
+}
+
+func (p *formulaParser) binary(ops string, operand func() (*node, error)) (*node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.operator(ops); op != 0; op = p.operator(ops) {
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *formulaParser) unary() (*node, error) {
+	if p.skipSpaces() >= len(p.text) {
+		return nil, errors.New("unexpected end")
+	}
+	switch ch := p.text[p.pos]; {
+	case ch == '-':
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &node{op: '-', left: &node{}, right: operand}, nil
+	case ch == '(':
+		p.pos++
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.operator(")") == 0 {
+			return nil, errors.New("unclosed parenthesis")
+		}
+		return inner, nil
+	case ch >= '0' && ch <= '9':
+		start := p.pos
+		for p.pos < len(p.text) && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+			p.pos++
+		}
+		v, err := strconv.ParseInt(p.text[start:p.pos], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &node{value: v}, nil
+	case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+		start := p.pos
+		for p.pos < len(p.text) && isNameChar(p.text[p.pos]) {
+			p.pos++
+		}
+		return &node{name: p.text[start:p.pos]}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", p.text[p.pos:])
+	}
+}
+
+func isNameChar(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
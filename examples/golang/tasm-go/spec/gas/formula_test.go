@@ -0,0 +1,67 @@
+package gas
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// TestFormula checks precedence, parentheses, unary minus and truncating division.
+func TestFormula(t *testing.T) {
+	env := map[string]int64{"n": 3, "m_2": 7}
+	tests := []struct {
+		text     string
+		expected int64
+		vars     []string
+	}{
+		{"42", 42, nil},
+		{"11375 + 630 * n + 8820 * n * n", 11375 + 630*3 + 8820*9, []string{"n"}},
+		{"-2650 + n * 4350", -2650 + 3*4350, []string{"n"}},
+		{"(m_2 - n) * (n + 1)", 16, []string{"m_2", "n"}},
+		{"10 - 4 - 3", 3, nil},
+		{"-m_2 / 2", -3, []string{"m_2"}},
+		{"- -n", 3, []string{"n"}},
+		{"\t1+2*3 ", 7, nil},
+	}
+	for _, test := range tests {
+		formula, err := Parse(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		if v, err := formula.Eval(env); err != nil || v != test.expected {
+			t.Errorf("%s: expected %d, got %d %v", test.text, test.expected, v, err)
+		}
+		if vars := formula.Vars(); !slices.Equal(vars, test.vars) {
+			t.Errorf("%s: expected variables %v, got %v", test.text, test.vars, vars)
+		}
+		if formula.String() != test.text {
+			t.Errorf("expected text %q, got %q", test.text, formula.String())
+		}
+	}
+}
+
+// TestFormulaErrors checks malformed formulas, including trailing garbage, and errors of evaluation.
+func TestFormulaErrors(t *testing.T) {
+	for _, text := range []string{"", "1 +", "(1 + 2", "1 + 2)", "2 n", "n * 3 ;", "1 % 2", "99999999999999999999"} {
+		if _, err := Parse(text); !errors.Is(err, ErrInvalidFormula) {
+			t.Errorf("%q: expected invalid formula, got %v", text, err)
+		}
+	}
+
+	formula, err := Parse("n * m + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := formula.Eval(map[string]int64{"n": 1}); !errors.Is(err, ErrUnboundVariable) {
+		t.Errorf("expected unbound variable m, got %v", err)
+	}
+
+	formula, err = Parse("10 / (n - 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := formula.Eval(map[string]int64{"n": 1}); err == nil {
+		t.Error("expected division by zero")
+	}
+}
@@ -0,0 +1,84 @@
+// Package gas computes gas consumption of TVM instructions: the static price of
+// an instruction from its encoded length and dynamic prices from GasConsumptionEntry formulas.
+package gas
+
+import (
+	"fmt"
+	"tasm-go/spec"
+)
+
+// Gas prices of TVM, see VmState in crypto/vm/vm.h of the TON repository.
+const (
+	// Every instruction costs PerInstruction plus PerBit for each bit of its encoding
+	PerInstruction = 10
+	PerBit         = 1
+	// Loading a cell for the first time and loading it again in the same transaction
+	CellLoad   = 100
+	CellReload = 25
+	CellCreate = 500
+	Exception  = 50
+	TupleEntry = 1
+	// Implicit jump to the first reference at the end of a cell, plus the cell load
+	ImplicitJmpRef = 10
+	// Implicit return at the end of a cell without references
+	ImplicitRet = 5
+	// Stack entries above FreeStackDepth cost StackEntry for operations copying the stack
+	FreeStackDepth = 32
+	StackEntry     = 1
+)
+
+// Static returns the gas charged before execution of an instruction of the given number of bits,
+// including its inline data, e.g. the bits of PUSHSLICE. TVM doesn't charge for references of
+// the instruction: loading the referenced cell costs CellLoad or CellReload, which is charged
+// by the instruction loading it, e.g. CALLREF, and is included in its entries of the specification.
+// Callers add the costs of leaving a cell, which don't belong to any instruction:
+//   - ImplicitJump when the end of the cell is reached and it has references
+//   - ImplicitRet when the end of the cell is reached and it has no references
+func Static(bits uint) int64 {
+	return PerInstruction + PerBit*int64(bits)
+}
+
+// ImplicitJump returns the gas of the implicit jump to the next cell of the code,
+// reloaded if the cell has already been loaded in the transaction.
+func ImplicitJump(reloaded bool) int64 {
+	if reloaded {
+		return ImplicitJmpRef + CellReload
+	}
+	return ImplicitJmpRef + CellLoad
+}
+
+// Entry returns the gas of the entry: its Formula evaluated with the environment if present, or the Value.
+func Entry(entry spec.GasConsumptionEntry, env map[string]int64) (int64, error) {
+	if entry.Formula == nil {
+		return entry.Value, nil
+	}
+	formula, err := Parse(*entry.Formula)
+	if err != nil {
+		return 0, err
+	}
+	v, err := formula.Eval(env)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", entry.Description, err)
+	}
+	return v, nil
+}
+
+// Range returns the minimum and maximum gas of the instruction over its entries, which describe
+// alternatives, e.g. whether a cell is loaded for the first time. Entries with formulas are evaluated
+// with the environment. It returns false if the instruction has no gas entries.
+func Range(instr *spec.Instruction, env map[string]int64) (lo, hi int64, ok bool, err error) {
+	for _, entry := range instr.Description.Gas {
+		v, err := Entry(entry, env)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("%s: %w", instr.Name, err)
+		}
+		if !ok || v < lo {
+			lo = v
+		}
+		if !ok || v > hi {
+			hi = v
+		}
+		ok = true
+	}
+	return lo, hi, ok, nil
+}
@@ -0,0 +1,32 @@
+package gas
+
+import (
+	"errors"
+	"tasm-go/spec"
+	"testing"
+)
+
+// TestRange checks gas of instructions of the specification with alternative values and with formulas.
+func TestRange(t *testing.T) {
+	registry, err := spec.NewRegistry(spec.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The base gas of ADD is the static gas of its 8 bits
+	if lo, hi, ok, err := Range(registry.ByName("ADD"), nil); lo != Static(8) || hi != Static(8) || !ok || err != nil {
+		t.Errorf("ADD: expected %d, got [%d, %d] %v %v", Static(8), lo, hi, ok, err)
+	}
+	// CALLREF loads or reloads the cell
+	if lo, hi, ok, err := Range(registry.ByName("CALLREF"), nil); lo != Static(16)+CellReload || hi != Static(16)+CellLoad || !ok || err != nil {
+		t.Errorf("CALLREF: expected [%d, %d], got [%d, %d] %v %v", Static(16)+CellReload, Static(16)+CellLoad, lo, hi, ok, err)
+	}
+
+	pairing := registry.ByName("BLS_PAIRING")
+	if lo, hi, ok, err := Range(pairing, map[string]int64{"n": 2}); lo != 20000+2*11800 || hi != lo || !ok || err != nil {
+		t.Errorf("BLS_PAIRING: expected %d, got [%d, %d] %v %v", 20000+2*11800, lo, hi, ok, err)
+	}
+	if _, _, _, err := Range(pairing, nil); !errors.Is(err, ErrUnboundVariable) {
+		t.Errorf("BLS_PAIRING: expected unbound variable n, got %v", err)
+	}
+}
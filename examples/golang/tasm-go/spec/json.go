@@ -0,0 +1,19 @@
+package spec
+
+import "encoding/json"
+
+// MarshalJSON keeps `"value": null` of Null constants, which is required for const entries
+// and omitted for others. The generated code can't distinguish null from a missing value.
+func (x StackEntry) MarshalJSON() ([]byte, error) {
+	type stackEntry StackEntry
+	if x.Type == Const && x.Value == nil {
+		return json.Marshal(struct {
+			stackEntry
+			Value *ConstantValue `json:"value"`
+		}{stackEntry: stackEntry(x)})
+	}
+	return json.Marshal(struct {
+		stackEntry
+		Value *ConstantValue `json:"value,omitempty"`
+	}{stackEntry: stackEntry(x), Value: x.Value})
+}
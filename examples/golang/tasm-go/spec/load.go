@@ -0,0 +1,47 @@
+package spec
+
+import (
+	_ "embed"
+	"io"
+	"os"
+	"sync"
+)
+
+// The specification is embedded, so binaries work without the repository checked out.
+// Run `go generate ./spec` after regenerating gen/tvm-specification.json.
+//
+//go:generate cp ../../../../gen/tvm-specification.json tvm-specification.json
+//go:embed tvm-specification.json
+var embedded []byte
+
+var defaultSpecification = sync.OnceValue(func() Specification {
+	s, err := UnmarshalSpecification(embedded)
+	if err != nil {
+		panic("spec: invalid embedded specification: " + err.Error())
+	}
+	return s
+})
+
+// Default returns the specification embedded into the module, its version is Specification.Version.
+// The result is shared between callers and must not be modified.
+func Default() Specification {
+	return defaultSpecification()
+}
+
+// Load reads the specification from a JSON file, e.g. a newer gen/tvm-specification.json.
+func Load(path string) (Specification, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Specification{}, err
+	}
+	return UnmarshalSpecification(data)
+}
+
+// LoadReader reads the specification in JSON from r.
+func LoadReader(r io.Reader) (Specification, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Specification{}, err
+	}
+	return UnmarshalSpecification(data)
+}
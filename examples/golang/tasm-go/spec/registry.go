@@ -0,0 +1,236 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidSpecification is returned by NewRegistry when opcode ranges of the
+// specification are empty, overlap or exceed 24 bits, or when two instructions
+// have the same name or prefix.
+var ErrInvalidSpecification = errors.New("instruction list is invalid")
+
+// MaxOpcodeBits is the maximum length of an instruction opcode.
+const MaxOpcodeBits = 24
+
+// Registry is an index of the specification built once for lookups of instructions
+// by name, opcode, category, tag, effect and implementation.
+// Registry is immutable after creation, so it is safe for concurrent use.
+// Returned slices are shared and must not be modified.
+type Registry struct {
+	instructions []*Instruction
+	// Sorted opcode ranges covering the whole 24-bit opcode space, see opcodeRanges
+	ranges []opcodeRange
+
+	byName        map[string]*Instruction
+	byPrefixStr   map[string]*Instruction
+	byCategory    map[string][]*Instruction
+	bySubCategory map[string][]*Instruction
+	byTag         map[string][]*Instruction
+	byEffect      map[Effect][]*Instruction
+	byExec        map[string][]*Instruction
+	fiftAliases   map[string]*FiftInstruction
+	fiftList      []*FiftInstruction
+}
+
+// opcodeRange is a range [min, max) of 24-bit opcodes, instr is nil for gaps between instructions.
+type opcodeRange struct {
+	min   int64
+	max   int64
+	instr *Instruction
+}
+
+// execFunctionRe matches the C++ function in Layout.Exec, e.g. `(_1) => exec_add(_1, false)`.
+var execFunctionRe = regexp.MustCompile(`\bexec_\w+`)
+
+// NewRegistry indexes the specification. It fails on the first invalid opcode range,
+// repeated name or prefix, use Validate to find all problems of the specification.
+// The instruction lists are copied, but the copy is shallow: layouts, descriptions and
+// other nested values are shared, so the specification must not be modified afterwards.
+func NewRegistry(tvmSpec Specification) (*Registry, error) {
+	// Appending to or replacing instructions of the specification doesn't affect the registry
+	instructions := slices.Clone(tvmSpec.Instructions)
+	fiftInstructions := slices.Clone(tvmSpec.FiftInstructions)
+
+	r := &Registry{
+		instructions:  make([]*Instruction, len(instructions)),
+		byName:        make(map[string]*Instruction),
+		byPrefixStr:   make(map[string]*Instruction),
+		byCategory:    make(map[string][]*Instruction),
+		bySubCategory: make(map[string][]*Instruction),
+		byTag:         make(map[string][]*Instruction),
+		byEffect:      make(map[Effect][]*Instruction),
+		byExec:        make(map[string][]*Instruction),
+		fiftAliases:   make(map[string]*FiftInstruction),
+	}
+	for i := range instructions {
+		instr := &instructions[i]
+		r.instructions[i] = instr
+		prefix := strings.ToUpper(instr.Layout.PrefixStr)
+		if r.byName[instr.Name] != nil {
+			return nil, fmt.Errorf("%w: duplicate name %s", ErrInvalidSpecification, instr.Name)
+		}
+		if other := r.byPrefixStr[prefix]; other != nil {
+			return nil, fmt.Errorf("%w: %s has the prefix %s of %s", ErrInvalidSpecification, instr.Name, prefix, other.Name)
+		}
+		r.byName[instr.Name] = instr
+		r.byPrefixStr[prefix] = instr
+		r.byCategory[instr.Category] = append(r.byCategory[instr.Category], instr)
+		r.bySubCategory[instr.SubCategory] = append(r.bySubCategory[instr.SubCategory], instr)
+		for _, tag := range instr.Description.Tags {
+			r.byTag[tag] = append(r.byTag[tag], instr)
+		}
+		for _, effect := range instr.Effects {
+			r.byEffect[effect] = append(r.byEffect[effect], instr)
+		}
+		if exec := ExecFunction(instr); exec != "" {
+			r.byExec[exec] = append(r.byExec[exec], instr)
+		}
+	}
+	for i := range fiftInstructions {
+		r.fiftAliases[fiftInstructions[i].Name] = &fiftInstructions[i]
+		r.fiftList = append(r.fiftList, &fiftInstructions[i])
+	}
+
+	var err error
+	r.ranges, err = opcodeRanges(r.instructions)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// opcodeRanges builds a sorted list of opcode ranges for efficient instruction lookup by opcode.
+// TVM instructions have opcode ranges, gaps between them are filled with
+// dummy ranges, so the list covers the whole 24-bit opcode space.
+func opcodeRanges(instructions []*Instruction) ([]opcodeRange, error) {
+	var instructionRanges []opcodeRange
+	for _, instr := range instructions {
+		instructionRanges = append(instructionRanges, opcodeRange{
+			min:   instr.Layout.Min,
+			max:   instr.Layout.Max,
+			instr: instr,
+		})
+	}
+
+	var list []opcodeRange
+	topOpcode := int64(1 << MaxOpcodeBits)
+	slices.SortFunc(instructionRanges, func(a, b opcodeRange) int {
+		return int(a.min - b.min)
+	})
+
+	upto := int64(0)
+	for _, instr := range instructionRanges {
+		if instr.min >= instr.max || instr.min < upto || instr.max > topOpcode {
+			return nil, fmt.Errorf("%w: %s: opcode range [%06X, %06X) is empty, overlaps or exceeds 24 bits",
+				ErrInvalidSpecification, instr.instr.Name, instr.min, instr.max)
+		}
+		if upto < instr.min {
+			// Fill gaps with dummy instructions for continuous opcode range
+			list = append(list, opcodeRange{min: upto, max: instr.min, instr: nil})
+		}
+		list = append(list, instr)
+		upto = instr.max
+	}
+
+	if upto < topOpcode {
+		list = append(list, opcodeRange{min: upto, max: topOpcode, instr: nil})
+	}
+
+	return list, nil
+}
+
+// ExecFunction returns the name of the C++ function implementing the instruction, e.g. `exec_add`.
+func ExecFunction(instr *Instruction) string {
+	if instr.Implementation != nil && instr.Implementation.FunctionName != "" {
+		return instr.Implementation.FunctionName
+	}
+	return execFunctionRe.FindString(instr.Layout.Exec)
+}
+
+// Instructions returns all instructions in the order of the specification.
+func (r *Registry) Instructions() []*Instruction {
+	return r.instructions
+}
+
+// ByName returns the instruction with the given name, e.g. `PUSHINT_4`, or nil.
+func (r *Registry) ByName(name string) *Instruction {
+	return r.byName[name]
+}
+
+// ByOpcode returns the instruction encoded by the first length bits of code, e.g.
+// ByOpcode(0xA0, 8) is ADD. The bits may contain arguments of the instruction, only
+// the first 24 bits are used. It returns nil if the bits are not a valid opcode or
+// are shorter than the opcode of the instruction.
+func (r *Registry) ByOpcode(bits uint64, length int) *Instruction {
+	if length > MaxOpcodeBits {
+		bits >>= length - MaxOpcodeBits
+		length = MaxOpcodeBits
+	}
+	if length <= 0 {
+		return nil
+	}
+	opcode := int64(bits&(1<<length-1)) << (MaxOpcodeBits - length)
+
+	// Binary search of the range containing the opcode
+	i, _ := slices.BinarySearchFunc(r.ranges, opcode, func(e opcodeRange, opcode int64) int {
+		if e.max <= opcode {
+			return -1
+		}
+		if e.min > opcode {
+			return 1
+		}
+		return 0
+	})
+	if i == len(r.ranges) {
+		return nil
+	}
+	instr := r.ranges[i].instr
+	if instr == nil || int64(length) < instr.Layout.CheckLen {
+		return nil
+	}
+	return instr
+}
+
+// ByPrefixStr returns the instruction with the given hex prefix, e.g. `A0` for ADD, or nil.
+func (r *Registry) ByPrefixStr(prefix string) *Instruction {
+	return r.byPrefixStr[strings.ToUpper(prefix)]
+}
+
+// ByCategory returns instructions of the category, e.g. `arithmetic`.
+func (r *Registry) ByCategory(category string) []*Instruction {
+	return r.byCategory[category]
+}
+
+// BySubCategory returns instructions of the sub-category, e.g. `cell_deserialize`.
+func (r *Registry) BySubCategory(subCategory string) []*Instruction {
+	return r.bySubCategory[subCategory]
+}
+
+// ByTag returns instructions with the tag in their description, e.g. `slice parsing`.
+func (r *Registry) ByTag(tag string) []*Instruction {
+	return r.byTag[tag]
+}
+
+// ByEffect returns instructions with the side effect, e.g. EffectCellLoad.
+func (r *Registry) ByEffect(effect Effect) []*Instruction {
+	return r.byEffect[effect]
+}
+
+// ByExecFunction returns instructions implemented by the C++ function, e.g. `exec_divmod`, see ExecFunction.
+func (r *Registry) ByExecFunction(name string) []*Instruction {
+	return r.byExec[name]
+}
+
+// FiftAlias returns the Fift instruction with the given name, e.g. `FALSE`, or nil.
+func (r *Registry) FiftAlias(name string) *FiftInstruction {
+	return r.fiftAliases[name]
+}
+
+// FiftAliases returns all Fift instructions in the order of the specification.
+func (r *Registry) FiftAliases() []*FiftInstruction {
+	return r.fiftList
+}
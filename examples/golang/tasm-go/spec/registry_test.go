@@ -0,0 +1,192 @@
+package spec
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func names(instructions []*Instruction) []string {
+	var result []string
+	for _, instr := range instructions {
+		result = append(result, instr.Name)
+	}
+	return result
+}
+
+func name(instr *Instruction) string {
+	if instr == nil {
+		return "<nil>"
+	}
+	return instr.Name
+}
+
+func TestRegistryByOpcode(t *testing.T) {
+	tvmSpec := Default()
+	r, err := NewRegistry(tvmSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qfitsx := r.ByName("QFITSX")
+	if qfitsx == nil || qfitsx.Layout.CheckLen != MaxOpcodeBits {
+		t.Fatal("expected QFITSX with a 24-bit opcode")
+	}
+	qfitsxOpcode := uint64(qfitsx.Layout.Min)
+
+	tests := []struct {
+		name     string
+		bits     uint64
+		length   int
+		expected string
+	}{
+		{"8-bit opcode", 0xa0, 8, "ADD"},
+		{"4-bit opcode", 0x7, 4, "PUSHINT_4"},
+		{"opcode with arguments", 0x80ff, 16, "PUSHINT_8"},
+		{"opcode shorter than check length", 0x8, 4, "<nil>"},
+		{"invalid opcode", 0xf8ff, 16, "<nil>"},
+		{"empty", 0, 0, "<nil>"},
+		{"24-bit opcode", qfitsxOpcode, 24, "QFITSX"},
+		{"24-bit opcode with arguments", qfitsxOpcode<<8 | 0xff, 32, "QFITSX"},
+		{"truncated 24-bit opcode", qfitsxOpcode >> 8, 16, "<nil>"},
+		{"last opcode", 1<<MaxOpcodeBits - 1, 24, "SETCP_SHORT"},
+		{"first opcode", 0, 24, "NOP"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if instr := r.ByOpcode(test.bits, test.length); name(instr) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, name(instr))
+			}
+		})
+	}
+
+	// Every instruction is found by the first and the last opcode of its range
+	for _, instr := range r.Instructions() {
+		if found := r.ByOpcode(uint64(instr.Layout.Min), MaxOpcodeBits); found != instr {
+			t.Errorf("%s: got %s", instr.Name, name(found))
+		}
+		if found := r.ByOpcode(uint64(instr.Layout.Max-1), MaxOpcodeBits); found != instr {
+			t.Errorf("%s: got %s", instr.Name, name(found))
+		}
+	}
+}
+
+func TestRegistryLookups(t *testing.T) {
+	tvmSpec := Default()
+	r, err := NewRegistry(tvmSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Instructions()) != len(tvmSpec.Instructions) || r.Instructions()[0].Name != tvmSpec.Instructions[0].Name {
+		t.Errorf("expected instructions in the order of the specification")
+	}
+	if name(r.ByName("PUSHINT_4")) != "PUSHINT_4" || r.ByName("PUSHINT") != nil {
+		t.Errorf("unexpected lookup by name")
+	}
+	if name(r.ByPrefixStr("a0")) != "ADD" || name(r.ByPrefixStr("CF20")) != "STREFCONST" || r.ByPrefixStr("F8FF") != nil {
+		t.Errorf("unexpected lookup by prefix")
+	}
+
+	lists := []struct {
+		lookup   string
+		found    []*Instruction
+		contains string
+		has      func(instr *Instruction) bool
+	}{
+		{"ByCategory", r.ByCategory("arithmetic"), "ADD", func(instr *Instruction) bool {
+			return instr.Category == "arithmetic"
+		}},
+		{"BySubCategory", r.BySubCategory("add_mul"), "ADD", func(instr *Instruction) bool {
+			return instr.SubCategory == "add_mul"
+		}},
+		{"ByTag", r.ByTag("builder building"), "STSLICECONST", func(instr *Instruction) bool {
+			return slices.Contains(instr.Description.Tags, "builder building")
+		}},
+		{"ByEffect", r.ByEffect("CellLoad"), "CTOS", func(instr *Instruction) bool {
+			return slices.Contains(instr.Effects, "CellLoad")
+		}},
+		{"ByExecFunction", r.ByExecFunction("exec_divmod"), "DIVMOD", func(instr *Instruction) bool {
+			return ExecFunction(instr) == "exec_divmod"
+		}},
+	}
+	for _, list := range lists {
+		t.Run(list.lookup, func(t *testing.T) {
+			if !slices.Contains(names(list.found), list.contains) {
+				t.Errorf("expected %s in %v", list.contains, names(list.found))
+			}
+			count := 0
+			for i := range tvmSpec.Instructions {
+				if list.has(&tvmSpec.Instructions[i]) {
+					count++
+				}
+			}
+			if count != len(list.found) {
+				t.Errorf("expected %d instructions, got %d", count, len(list.found))
+			}
+			for _, instr := range list.found {
+				if !list.has(instr) {
+					t.Errorf("unexpected %s", instr.Name)
+				}
+			}
+		})
+	}
+	if r.ByCategory("unknown") != nil || r.ByTag("unknown") != nil || r.ByExecFunction("exec_unknown") != nil {
+		t.Errorf("expected no instructions for unknown keys")
+	}
+
+	if alias := r.FiftAlias("-ROT"); alias == nil || alias.ActualName != "ROTREV" {
+		t.Errorf("expected -ROT to be ROTREV, got %+v", alias)
+	}
+	if r.FiftAlias("ROTREV") != nil {
+		t.Errorf("expected no Fift alias for a TVM instruction")
+	}
+	if len(r.FiftAliases()) != len(tvmSpec.FiftInstructions) {
+		t.Errorf("expected %d Fift aliases, got %d", len(tvmSpec.FiftInstructions), len(r.FiftAliases()))
+	}
+}
+
+// TestRegistryCopy checks that the registry doesn't see later changes of the instruction lists.
+func TestRegistryCopy(t *testing.T) {
+	tvmSpec := Default()
+	tvmSpec.Instructions = slices.Clone(tvmSpec.Instructions)
+	r, err := NewRegistry(tvmSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tvmSpec.Instructions[0] = Instruction{Name: "REPLACED"}
+	if r.ByName("REPLACED") != nil || r.Instructions()[0].Name == "REPLACED" {
+		t.Errorf("expected the registry to keep its instructions")
+	}
+}
+
+func TestNewRegistryInvalid(t *testing.T) {
+	instruction := func(name, prefix string, min, max int64) Instruction {
+		return Instruction{Name: name, Layout: Layout{PrefixStr: prefix, Min: min, Max: max, CheckLen: 8}}
+	}
+	tests := []struct {
+		name         string
+		instructions []Instruction
+	}{
+		{"empty range", []Instruction{instruction("A", "00", 0, 0)}},
+		{"overlapping ranges", []Instruction{instruction("A", "00", 0, 0x20000), instruction("B", "01", 0x10000, 0x30000)}},
+		{"range over 24 bits", []Instruction{instruction("A", "FF", 0xff0000, 0x1000001)}},
+		{"duplicate name", []Instruction{instruction("A", "00", 0, 0x10000), instruction("A", "01", 0x10000, 0x20000)}},
+		{"duplicate prefix", []Instruction{instruction("A", "00", 0, 0x10000), instruction("B", "00", 0x10000, 0x20000)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewRegistry(Specification{Instructions: test.instructions})
+			if !errors.Is(err, ErrInvalidSpecification) {
+				t.Errorf("expected ErrInvalidSpecification, got %v", err)
+			}
+		})
+	}
+
+	// Adjacent ranges up to the last opcode are valid
+	_, err := NewRegistry(Specification{Instructions: []Instruction{
+		instruction("A", "00", 0, 0x10000), instruction("B", "01", 0x10000, 1<<MaxOpcodeBits),
+	}})
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,123 @@
+package signature
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"tasm-go/spec"
+)
+
+// Check parses stack strings of all instructions and compares them with the structured
+// signatures. Names of arrays and conditionals are not compared, since stack strings don't have them.
+func Check(tvmSpec spec.Specification) []spec.Problem {
+	var problems []spec.Problem
+	for i := range tvmSpec.Instructions {
+		instr := &tvmSpec.Instructions[i]
+		parsed, ok, err := ParseInstruction(instr)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			problems = append(problems, spec.Problem{Instruction: instr.Name, Message: err.Error()})
+			continue
+		}
+		structured, _ := Of(instr)
+		for _, message := range compareEntries("inputs", parsed.Inputs, structured.Inputs) {
+			problems = append(problems, spec.Problem{Instruction: instr.Name, Message: message})
+		}
+		for _, message := range compareEntries("outputs", parsed.Outputs, structured.Outputs) {
+			problems = append(problems, spec.Problem{Instruction: instr.Name, Message: message})
+		}
+	}
+	return problems
+}
+
+// compareEntries describes differences between entries parsed from the stack string and the structured ones.
+func compareEntries(path string, parsed, structured []spec.StackEntry) []string {
+	if len(parsed) != len(structured) {
+		return []string{fmt.Sprintf("%s: stack string has %d entries, structured signature has %d", path, len(parsed), len(structured))}
+	}
+	var problems []string
+	for i := range parsed {
+		a, b := parsed[i], structured[i]
+		at := fmt.Sprintf("%s[%d]", path, i)
+		if a.Type != b.Type {
+			problems = append(problems, fmt.Sprintf("%s: stack string has %s entry, structured signature has %s", at, a.Type, b.Type))
+			continue
+		}
+		switch a.Type {
+		case spec.TypeSimple:
+			if name(a) != name(b) {
+				problems = append(problems, fmt.Sprintf("%s: name %s differs from %s", at, name(a), name(b)))
+			}
+			if !sameTypes(a.ValueTypes, b.ValueTypes) {
+				problems = append(problems, fmt.Sprintf("%s: types %v of %s differ from %v", at, a.ValueTypes, name(a), b.ValueTypes))
+			}
+		case spec.Const:
+			if constant(a) != constant(b) {
+				problems = append(problems, fmt.Sprintf("%s: constant %s differs from %s", at, constant(a), constant(b)))
+			}
+		case spec.Array:
+			if a.LengthVar == nil || b.LengthVar == nil || *a.LengthVar != *b.LengthVar {
+				problems = append(problems, fmt.Sprintf("%s: array length %s differs from %s", at, lengthVar(a), lengthVar(b)))
+			}
+		case spec.Conditional:
+			if len(a.Match) != len(b.Match) {
+				problems = append(problems, fmt.Sprintf("%s: stack string has %d arms, structured signature has %d", at, len(a.Match), len(b.Match)))
+				continue
+			}
+			for j := range a.Match {
+				if a.Match[j].Value != b.Match[j].Value {
+					problems = append(problems, fmt.Sprintf("%s: arm value %d differs from %d", at, a.Match[j].Value, b.Match[j].Value))
+				}
+				problems = append(problems, compareEntries(fmt.Sprintf("%s.match[%d]", at, j), a.Match[j].Stack, b.Match[j].Stack)...)
+			}
+			problems = append(problems, compareEntries(at+".else", a.Else, b.Else)...)
+		}
+	}
+	return problems
+}
+
+func name(entry spec.StackEntry) string {
+	if entry.Name == nil {
+		return "<unnamed>"
+	}
+	return *entry.Name
+}
+
+func lengthVar(entry spec.StackEntry) string {
+	if entry.LengthVar == nil {
+		return "<none>"
+	}
+	return *entry.LengthVar
+}
+
+// constant formats the constant, integers may be numbers or strings in the specification.
+func constant(entry spec.StackEntry) string {
+	valueType := "?"
+	if entry.ValueType != nil {
+		valueType = string(*entry.ValueType)
+	}
+	switch {
+	case entry.Value == nil:
+		return valueType + " null"
+	case entry.Value.Integer != nil:
+		return valueType + " " + strconv.FormatInt(*entry.Value.Integer, 10)
+	case entry.Value.String != nil:
+		return valueType + " " + *entry.Value.String
+	}
+	return valueType + " null"
+}
+
+// sameTypes compares possible types, missing types mean any value.
+func sameTypes(a, b []spec.PossibleValueType) bool {
+	normalize := func(types []spec.PossibleValueType) []spec.PossibleValueType {
+		if len(types) == 0 {
+			return []spec.PossibleValueType{spec.Any}
+		}
+		types = slices.Clone(types)
+		slices.Sort(types)
+		return types
+	}
+	return slices.Equal(normalize(a), normalize(b))
+}
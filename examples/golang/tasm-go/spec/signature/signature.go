@@ -0,0 +1,366 @@
+// Package signature parses stack signatures of instructions and resolves stack effects
+// of instructions against their decoded operands.
+//
+// InstructionSignature describes the stack twice: as the structured Inputs/Outputs tree
+// and as the human-readable StackString, e.g.
+//
+//	c:Cell b:Builder -> (b':Builder 0)|(c:Cell b:Builder -1) status:Int
+//
+// Parse converts StackString into the same spec.StackEntry model, and Check cross-checks both.
+package signature
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"tasm-go/spec"
+)
+
+// ErrInvalidStackString is returned by Parse for malformed stack strings.
+var ErrInvalidStackString = errors.New("invalid stack string")
+
+// Signature is the stack effect of an instruction, the top of the stack is the last entry.
+type Signature struct {
+	Inputs  []spec.StackEntry
+	Outputs []spec.StackEntry
+	// Names of the instruction operands, which are referred to by LengthVar
+	operands []string
+}
+
+// Of returns the structured signature of the instruction, false if the specification doesn't describe it.
+func Of(instr *spec.Instruction) (Signature, bool) {
+	if instr.Signature == nil {
+		return Signature{}, false
+	}
+	s := Signature{operands: operandNames(instr)}
+	if instr.Signature.Inputs != nil {
+		s.Inputs = instr.Signature.Inputs.Stack
+	}
+	if instr.Signature.Outputs != nil {
+		s.Outputs = instr.Signature.Outputs.Stack
+	}
+	return s, true
+}
+
+// ParseInstruction parses StackString of the instruction, false if it has no stack string.
+func ParseInstruction(instr *spec.Instruction) (Signature, bool, error) {
+	if instr.Signature == nil || instr.Signature.StackString == nil {
+		return Signature{}, false, nil
+	}
+	s, err := Parse(*instr.Signature.StackString)
+	if err != nil {
+		return Signature{}, true, fmt.Errorf("%s: %w", instr.Name, err)
+	}
+	s.operands = operandNames(instr)
+	return s, true, nil
+}
+
+func operandNames(instr *spec.Instruction) []string {
+	names := make([]string, len(instr.Layout.Args))
+	for i, arg := range instr.Layout.Args {
+		names[i] = arg.Name
+	}
+	return names
+}
+
+var (
+	// Array of values, e.g. `x_1...x_n`
+	arrayRe = regexp.MustCompile(`^([A-Za-z]\w*?)_1\.\.\.([A-Za-z]\w*?)_([A-Za-z]\w*)$`)
+	// Typed value, e.g. `D:Cell|Null`
+	simpleRe = regexp.MustCompile(`^([A-Za-z_][\w']*):([A-Za-z]+(?:\|[A-Za-z]+)*)$`)
+)
+
+// Parse parses a stack string, e.g. `x:Int y:Int -> result:Int`. Entries are:
+//
+//	x:Int|Null                       simple value with possible types
+//	0, -1, NaN, null                 constant
+//	x_1...x_n                        array of n values
+//	(a:Int 0)|(b:Cell -1)            conditional, each arm ends with the matched value of the variable,
+//	(∅ 0)|null null                  optionally followed by the else arm of constants
+//
+// The empty stack is `∅`. Names of conditionals and arrays aren't present in stack strings,
+// arrays are named by their elements, e.g. `x`.
+func Parse(stackString string) (Signature, error) {
+	inputs, outputs, ok := strings.Cut(stackString, "->")
+	if !ok || strings.Contains(outputs, "->") {
+		return Signature{}, fmt.Errorf("%w: %q", ErrInvalidStackString, stackString)
+	}
+	var s Signature
+	var err error
+	if s.Inputs, err = parseSide(inputs); err != nil {
+		return Signature{}, fmt.Errorf("%w: %q: %w", ErrInvalidStackString, stackString, err)
+	}
+	if s.Outputs, err = parseSide(outputs); err != nil {
+		return Signature{}, fmt.Errorf("%w: %q: %w", ErrInvalidStackString, stackString, err)
+	}
+	return s, nil
+}
+
+// tokenize splits a side of the stack string into words, parentheses and `|` between conditional arms.
+func tokenize(side string) []string {
+	var tokens []string
+	word := strings.Builder{}
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range side {
+		switch {
+		case r == ' ' || r == '\t':
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == '|' && word.Len() == 0:
+			// `|` inside words separates types, e.g. Cell|Null
+			tokens = append(tokens, "|")
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func parseSide(side string) ([]spec.StackEntry, error) {
+	p := &parser{tokens: tokenize(side)}
+	entries, err := p.entries()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.peek())
+	}
+	return entries, nil
+}
+
+// entries parses entries until the end of the side or the closing parenthesis.
+func (p *parser) entries() ([]spec.StackEntry, error) {
+	entries := []spec.StackEntry{}
+	for {
+		switch token := p.peek(); token {
+		case "", ")", "|":
+			return entries, nil
+		case "∅":
+			p.next()
+		case "(":
+			entry, err := p.conditional()
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		default:
+			p.next()
+			entry, err := parseWord(token)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+}
+
+// conditional parses arms `(entries value)|(entries value)` and the optional else arm of constants.
+func (p *parser) conditional() (spec.StackEntry, error) {
+	entry := spec.StackEntry{Type: spec.Conditional}
+	for p.peek() == "(" {
+		p.next()
+		stack, err := p.entries()
+		if err != nil {
+			return entry, err
+		}
+		if p.next() != ")" {
+			return entry, errors.New("unclosed parenthesis")
+		}
+		if len(stack) == 0 || stack[len(stack)-1].Type != spec.Const || stack[len(stack)-1].Value == nil ||
+			stack[len(stack)-1].Value.Integer == nil {
+			return entry, errors.New("conditional arm doesn't end with a matched value")
+		}
+		value := *stack[len(stack)-1].Value.Integer
+		entry.Match = append(entry.Match, spec.MatchArm{Stack: stack[:len(stack)-1], Value: value})
+		if p.peek() != "|" {
+			return entry, nil
+		}
+		p.next()
+	}
+
+	// Else arm is the empty stack or constants up to the next value
+	entry.Else = []spec.StackEntry{}
+	if p.peek() == "∅" {
+		p.next()
+		return entry, nil
+	}
+	for token := p.peek(); token != "" && token != "(" && token != ")" && token != "|"; token = p.peek() {
+		constant, err := parseWord(token)
+		if err != nil {
+			return entry, err
+		}
+		if constant.Type != spec.Const {
+			break
+		}
+		p.next()
+		entry.Else = append(entry.Else, constant)
+	}
+	if len(entry.Else) == 0 {
+		return entry, errors.New("empty else arm")
+	}
+	return entry, nil
+}
+
+// parseWord parses a simple value, a constant or an array.
+func parseWord(word string) (spec.StackEntry, error) {
+	if m := simpleRe.FindStringSubmatch(word); m != nil {
+		entry := spec.StackEntry{Type: spec.TypeSimple, Name: &m[1]}
+		for _, t := range strings.Split(m[2], "|") {
+			entry.ValueTypes = append(entry.ValueTypes, spec.PossibleValueType(t))
+		}
+		return entry, nil
+	}
+	if m := arrayRe.FindStringSubmatch(word); m != nil && m[1] == m[2] {
+		return spec.StackEntry{
+			Type:       spec.Array,
+			Name:       &m[1],
+			LengthVar:  &m[3],
+			ArrayEntry: []spec.StackEntry{{Type: spec.TypeSimple, Name: &m[1]}},
+		}, nil
+	}
+	switch word {
+	case "null":
+		valueType := spec.ConstantTypeNull
+		return spec.StackEntry{Type: spec.Const, ValueType: &valueType}, nil
+	case "NaN":
+		valueType := spec.ConstantTypeInt
+		return spec.StackEntry{Type: spec.Const, ValueType: &valueType, Value: &spec.ConstantValue{String: &word}}, nil
+	}
+	if v, err := strconv.ParseInt(word, 10, 64); err == nil {
+		valueType := spec.ConstantTypeInt
+		return spec.StackEntry{Type: spec.Const, ValueType: &valueType, Value: &spec.ConstantValue{Integer: &v}}, nil
+	}
+	return spec.StackEntry{}, fmt.Errorf("unknown entry %q", word)
+}
+
+// PopCount returns the number of values taken from the stack, resolving lengths of arrays
+// against the decoded operands of the instruction, see operandValue. It returns false if the number
+// depends on values on the stack, e.g. for CALLXVARARGS.
+func (s Signature) PopCount(args []any) (int, bool) {
+	return s.count(s.Inputs, args)
+}
+
+// PushCount returns the number of values put on the stack, see PopCount. It returns false
+// if the number depends on values on the stack, including conditionals with arms of different sizes.
+func (s Signature) PushCount(args []any) (int, bool) {
+	return s.count(s.Outputs, args)
+}
+
+func (s Signature) count(entries []spec.StackEntry, args []any) (int, bool) {
+	total := 0
+	for _, entry := range entries {
+		switch entry.Type {
+		case spec.TypeSimple, spec.Const:
+			total++
+		case spec.Array:
+			if entry.LengthVar == nil {
+				return 0, false
+			}
+			length, ok := s.Operand(*entry.LengthVar, args)
+			if !ok {
+				return 0, false
+			}
+			size, ok := s.count(entry.ArrayEntry, args)
+			if !ok {
+				return 0, false
+			}
+			total += int(length) * size
+		case spec.Conditional:
+			arms := make([][]spec.StackEntry, 0, len(entry.Match)+1)
+			for _, arm := range entry.Match {
+				arms = append(arms, arm.Stack)
+			}
+			if entry.Else != nil {
+				arms = append(arms, entry.Else)
+			}
+			size := -1
+			for _, arm := range arms {
+				n, ok := s.count(arm, args)
+				if !ok || (size >= 0 && n != size) {
+					return 0, false
+				}
+				size = n
+			}
+			total += max(size, 0)
+		default:
+			return 0, false
+		}
+	}
+	return total, true
+}
+
+// Operand returns the value of the named operand, e.g. the length of an array,
+// false if there is no such operand or it's not an integer.
+func (s Signature) Operand(name string, args []any) (int64, bool) {
+	for i, operand := range s.operands {
+		if operand == name && i < len(args) {
+			return operandValue(args[i])
+		}
+	}
+	return 0, false
+}
+
+// operandValue converts a decoded operand to an integer, operands are int64, uint64 or *big.Int.
+func operandValue(arg any) (int64, bool) {
+	switch v := arg.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), v <= 1<<63-1
+	case *big.Int:
+		return v.Int64(), v.IsInt64()
+	}
+	return 0, false
+}
+
+// LengthChange returns the number of bits added by Mutations of the entry, e.g. for STU,
+// false if it depends on values on the stack, e.g. for STUX.
+func (s Signature) LengthChange(entry spec.StackEntry, args []any) (int64, bool) {
+	var total int64
+	for _, mutation := range entry.Mutations {
+		if mutation.Length.AmountArg == nil {
+			return 0, false
+		}
+		index := int(*mutation.Length.AmountArg)
+		if index < 0 || index >= len(args) {
+			return 0, false
+		}
+		amount, ok := operandValue(args[index])
+		if !ok {
+			return 0, false
+		}
+		total += amount
+	}
+	return total, true
+}
@@ -0,0 +1,106 @@
+package signature
+
+import (
+	"errors"
+	"tasm-go/spec"
+	"testing"
+)
+
+// TestParse checks entries of each kind parsed from stack strings and the errors of malformed ones.
+func TestParse(t *testing.T) {
+	s, err := Parse("c:Cell b:Builder -> (b':Builder 0)|(c:Cell b:Builder -1) status:Int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Inputs) != 2 || *s.Inputs[0].Name != "c" || *s.Inputs[1].Name != "b" || s.Inputs[1].ValueTypes[0] != "Builder" {
+		t.Errorf("unexpected inputs %+v", s.Inputs)
+	}
+	if len(s.Outputs) != 2 || s.Outputs[0].Type != spec.Conditional || *s.Outputs[1].Name != "status" {
+		t.Fatalf("unexpected outputs %+v", s.Outputs)
+	}
+	if arms := s.Outputs[0].Match; len(arms) != 2 || arms[0].Value != 0 || len(arms[0].Stack) != 1 || arms[1].Value != -1 || len(arms[1].Stack) != 2 {
+		t.Errorf("unexpected arms %+v", arms)
+	}
+	if n, ok := s.PopCount(nil); n != 2 || !ok {
+		t.Errorf("expected 2 inputs, got %d %v", n, ok)
+	}
+	// Arms put 1 or 2 values
+	if _, ok := s.PushCount(nil); ok {
+		t.Error("expected unknown number of outputs")
+	}
+
+	s, err = Parse("x:Int -> (∅ 0)|null null")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := s.Outputs[0]; len(e.Match) != 1 || len(e.Match[0].Stack) != 0 || len(e.Else) != 2 || *e.Else[0].ValueType != spec.ConstantTypeNull {
+		t.Errorf("unexpected conditional %+v", e)
+	}
+
+	for _, invalid := range []string{"x:Int", "x:Int -> y:Int -> z:Int", "x:Int -> (y:Int 0", "x:Int -> (y:Int)", "x -> y:Int"} {
+		if _, err := Parse(invalid); !errors.Is(err, ErrInvalidStackString) {
+			t.Errorf("%s: expected invalid stack string, got %v", invalid, err)
+		}
+	}
+}
+
+// TestCounts checks resolving array lengths and mutations against operands of instructions of the specification.
+func TestCounts(t *testing.T) {
+	registry, err := spec.NewRegistry(spec.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := func(name string) Signature {
+		s, ok := Of(registry.ByName(name))
+		if !ok {
+			t.Fatalf("no signature of %s", name)
+		}
+		return s
+	}
+
+	// x_1...x_n -> t:Tuple
+	tuple := signature("TUPLE")
+	if n, ok := tuple.PopCount([]any{int64(3)}); n != 3 || !ok {
+		t.Errorf("TUPLE 3: expected 3 inputs, got %d %v", n, ok)
+	}
+	if n, ok := tuple.PushCount([]any{int64(3)}); n != 1 || !ok {
+		t.Errorf("TUPLE 3: expected 1 output, got %d %v", n, ok)
+	}
+	// The number of values is on the stack
+	if _, ok := signature("CALLXVARARGS").PopCount(nil); ok {
+		t.Error("CALLXVARARGS: expected unknown number of inputs")
+	}
+
+	stu := signature("STU")
+	if n, ok := stu.LengthChange(stu.Outputs[0], []any{int64(32)}); n != 32 || !ok {
+		t.Errorf("STU 32: expected 32 bits stored, got %d %v", n, ok)
+	}
+	stux := signature("STUX")
+	if _, ok := stux.LengthChange(stux.Outputs[0], nil); ok {
+		t.Error("STUX: expected unknown number of bits stored")
+	}
+}
+
+// TestCheck checks that stack strings of the specification match the structured signatures,
+// and that a stack string with a missing output is reported.
+func TestCheck(t *testing.T) {
+	for _, problem := range Check(spec.Default()) {
+		t.Error(problem)
+	}
+
+	structured, err := Parse("x:Int y:Int -> z:Int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackString := "x:Int y:Int -> ∅"
+	instr := spec.Instruction{Name: "ADD", Signature: &spec.InstructionSignature{
+		Inputs:      &spec.InstructionInputs{Stack: structured.Inputs},
+		Outputs:     &spec.InstructionOutputs{Stack: structured.Outputs},
+		StackString: &stackString,
+	}}
+	problems := Check(spec.Specification{Instructions: []spec.Instruction{instr}})
+	expected := spec.Problem{Instruction: "ADD", Message: "outputs: stack string has 0 entries, structured signature has 1"}
+	if len(problems) != 1 || problems[0] != expected {
+		t.Errorf("expected %v, got %v", expected, problems)
+	}
+}
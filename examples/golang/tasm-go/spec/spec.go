@@ -1,4 +1,11 @@
-// Code generated from JSON Schema using quicktype. DO NOT EDIT.
+// Generated from gen/schema.json using quicktype and extended by hand, so the model
+// round-trips the specification losslessly, see spec_test.go. Keep when regenerating:
+//
+//   - Arg.Name and the Dict argument kind
+//   - Effect constants
+//   - omitzero for arrays, which are either absent or empty in the specification
+//   - StackEntry.MarshalJSON in json.go, which keeps null values of constants
+//
 // To parse and unparse this JSON data, add this code to your project and do:
 //
 //    specification, err := UnmarshalSpecification(bytes)
@@ -33,7 +40,7 @@ type FiftInstruction struct {
 	// The actual TVM instruction name
 	ActualName                                          string         `json:"actual_name"`
 	// List of arguments for the instruction
-	Arguments                                           []FiftArgument `json:"arguments,omitempty"`
+	Arguments                                           []FiftArgument `json:"arguments,omitzero"`
 	// Optional description of what the instruction does
 	Description                                         *string        `json:"description,omitempty"`
 	// The unique name of the Fift instruction
@@ -47,7 +54,7 @@ type Instruction struct {
 	ControlFlow                                                                 *ControlFlowOfInstruction `json:"control_flow,omitempty"`
 	Description                                                                 Description               `json:"description"`
 	// List of side effects that this instruction may have
-	Effects                                                                     []string                  `json:"effects,omitempty"`
+	Effects                                                                     []Effect                  `json:"effects,omitzero"`
 	Implementation                                                              *ImplementationInfo       `json:"implementation,omitempty"`
 	Layout                                                                      Layout                    `json:"layout"`
 	// The unique name of the instruction
@@ -94,25 +101,25 @@ type Continuation struct {
 // information
 type Description struct {
 	// List of documentation links related to this instruction
-	DocsLinks                                                      []DocsLink            `json:"docs_links,omitempty"`
+	DocsLinks                                                      []DocsLink            `json:"docs_links,omitzero"`
 	// List of examples showing how to use this instruction
-	Examples                                                       []Example             `json:"examples,omitempty"`
+	Examples                                                       []Example             `json:"examples,omitzero"`
 	// List of possible exit codes and their conditions
-	ExitCodes                                                      []ExitCode            `json:"exit_codes,omitempty"`
+	ExitCodes                                                      []ExitCode            `json:"exit_codes,omitzero"`
 	// List of gas consumption entries for this instruction
-	Gas                                                            []GasConsumptionEntry `json:"gas,omitempty"`
+	Gas                                                            []GasConsumptionEntry `json:"gas,omitzero"`
 	// Detailed description of the instruction's functionality
 	Long                                                           string                `json:"long"`
 	// List of operand names
 	Operands                                                       []string              `json:"operands"`
 	// List of alternative implementations of this instruction
-	OtherImplementations                                           []OtherImplementation `json:"other_implementations,omitempty"`
+	OtherImplementations                                           []OtherImplementation `json:"other_implementations,omitzero"`
 	// List of instructions that are related or similar to this one
-	RelatedInstructions                                            []string              `json:"related_instructions,omitempty"`
+	RelatedInstructions                                            []string              `json:"related_instructions,omitzero"`
 	// Brief one-line description of the instruction
 	Short                                                          string                `json:"short"`
 	// List of tags for categorizing and searching instructions
-	Tags                                                           []string              `json:"tags,omitempty"`
+	Tags                                                           []string              `json:"tags,omitzero"`
 }
 
 // Represents a link to documentation with name and URL
@@ -224,6 +231,8 @@ type Layout struct {
 // Bits argument for inline code slice
 type Arg struct {
 	Empty                                   Empty     `json:"$"`
+	// Name of the argument
+	Name                                    string    `json:"name,omitempty"`
 	// Length of the argument in bits
 	Len                                     *int64    `json:"len,omitempty"`
 	// Value range for the uint argument
@@ -292,8 +301,8 @@ type InstructionSignature struct {
 
 // Incoming values constraints.
 type InstructionInputs struct {
-	Registers []Register   `json:"registers,omitempty"`
-	Stack     []StackEntry `json:"stack,omitempty"`
+	Registers []Register   `json:"registers,omitzero"`
+	Stack     []StackEntry `json:"stack,omitzero"`
 }
 
 // Represents read/write access to a register
@@ -313,18 +322,18 @@ type MatchArm struct {
 //
 // Representation of stack entry or group of stack entries
 type StackEntry struct {
-	Mutations                                                                                []Mutation          `json:"mutations,omitempty"`
+	Mutations                                                                                []Mutation          `json:"mutations,omitzero"`
 	Name                                                                                     *string             `json:"name,omitempty"`
 	Presentation                                                                             *string             `json:"presentation,omitempty"`
 	// Optional range constraint for the value, specifying minimum and maximum allowed values
 	Range                                                                                    *PossibleValueRange `json:"range,omitempty"`
 	Type                                                                                     StackEntryType      `json:"type"`
-	ValueTypes                                                                               []PossibleValueType `json:"value_types,omitempty"`
+	ValueTypes                                                                               []PossibleValueType `json:"value_types,omitzero"`
 	Value                                                                                    *ConstantValue      `json:"value"`
 	ValueType                                                                                *ConstantType       `json:"value_type,omitempty"`
-	Else                                                                                     []StackEntry        `json:"else,omitempty"`
-	Match                                                                                    []MatchArm          `json:"match,omitempty"`
-	ArrayEntry                                                                               []StackEntry        `json:"array_entry,omitempty"`
+	Else                                                                                     []StackEntry        `json:"else,omitzero"`
+	Match                                                                                    []MatchArm          `json:"match,omitzero"`
+	ArrayEntry                                                                               []StackEntry        `json:"array_entry,omitzero"`
 	LengthVar                                                                                *string             `json:"length_var,omitempty"`
 }
 
@@ -349,8 +358,8 @@ type PossibleValueRange struct {
 
 // Outgoing values constraints.
 type InstructionOutputs struct {
-	Registers []Register   `json:"registers,omitempty"`
-	Stack     []StackEntry `json:"stack,omitempty"`
+	Registers []Register   `json:"registers,omitzero"`
+	Stack     []StackEntry `json:"stack,omitzero"`
 }
 
 type ContinuationName string
@@ -379,6 +388,7 @@ const (
 	Control         Empty = "control"
 	Debugstr        Empty = "debugstr"
 	Delta           Empty = "delta"
+	Dict            Empty = "dict"
 	ExoticCell      Empty = "exoticCell"
 	InlineCodeSlice Empty = "inlineCodeSlice"
 	Int             Empty = "int"
@@ -394,6 +404,39 @@ const (
 	Uint            Empty = "uint"
 )
 
+// Side effect of an instruction
+type Effect string
+
+const (
+	EffectAlwaysThrow                  Effect = "AlwaysThrow"
+	EffectBlsG1AddSub                  Effect = "BlsG1AddSub"
+	EffectBlsG1InGroup                 Effect = "BlsG1InGroup"
+	EffectBlsG1Mul                     Effect = "BlsG1Mul"
+	EffectBlsG1Neg                     Effect = "BlsG1Neg"
+	EffectBlsG2AddSub                  Effect = "BlsG2AddSub"
+	EffectBlsG2InGroup                 Effect = "BlsG2InGroup"
+	EffectBlsG2Mul                     Effect = "BlsG2Mul"
+	EffectBlsG2Neg                     Effect = "BlsG2Neg"
+	EffectBlsMapToG1                   Effect = "BlsMapToG1"
+	EffectBlsMapToG2                   Effect = "BlsMapToG2"
+	EffectBlsVerify                    Effect = "BlsVerify"
+	EffectCanThrow                     Effect = "CanThrow"
+	EffectCellCreate                   Effect = "CellCreate"
+	EffectCellLoad                     Effect = "CellLoad"
+	EffectChksign                      Effect = "Chksign"
+	EffectDynamicGas                   Effect = "DynamicGas"
+	EffectEcrecover                    Effect = "Ecrecover"
+	EffectImplicitJumpRef              Effect = "ImplicitJumpRef"
+	EffectP256Chksign                  Effect = "P256Chksign"
+	EffectRist255Add                   Effect = "Rist255Add"
+	EffectRist255Fromhash              Effect = "Rist255Fromhash"
+	EffectRist255Mul                   Effect = "Rist255Mul"
+	EffectRist255Mulbase               Effect = "Rist255Mulbase"
+	EffectRist255Validate              Effect = "Rist255Validate"
+	EffectSecp256K1XonlyPubkeyTweakAdd Effect = "Secp256k1XonlyPubkeyTweakAdd"
+	EffectTuple                        Effect = "Tuple"
+)
+
 // Type of instruction layout format
 type Kind string
 
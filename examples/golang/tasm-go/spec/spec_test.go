@@ -0,0 +1,72 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestRoundTrip checks that the Go model keeps every field of the specification.
+func TestRoundTrip(t *testing.T) {
+	tvmSpec, err := UnmarshalSpecification(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tvmSpec.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var original, marshaled any
+	if err := json.Unmarshal(embedded, &original); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &marshaled); err != nil {
+		t.Fatal(err)
+	}
+	for _, diff := range diffJSON("", original, marshaled) {
+		t.Error(diff)
+	}
+}
+
+// diffJSON compares decoded JSON values and describes up to 20 differences.
+func diffJSON(path string, a, b any) []string {
+	var diffs []string
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %v != %v", path, a, b)}
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok {
+				diffs = append(diffs, fmt.Sprintf("%s/%s: missing", path, key))
+				continue
+			}
+			diffs = append(diffs, diffJSON(path+"/"+key, value, other)...)
+		}
+		for key := range b {
+			if _, ok := a[key]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s/%s: unexpected", path, key))
+			}
+		}
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return []string{fmt.Sprintf("%s: %v != %v", path, a, b)}
+		}
+		for i := range a {
+			diffs = append(diffs, diffJSON(fmt.Sprintf("%s/%d", path, i), a[i], b[i])...)
+		}
+	default:
+		if !reflect.DeepEqual(a, b) {
+			diffs = append(diffs, fmt.Sprintf("%s: %v != %v", path, a, b))
+		}
+	}
+	if len(diffs) > 20 {
+		diffs = diffs[:20]
+	}
+	return diffs
+}
@@ -0,0 +1,264 @@
+package spec
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Problem is an inconsistency of the specification found by Validate.
+type Problem struct {
+	// Name of the instruction or the Fift instruction
+	Instruction string
+	Message     string
+}
+
+func (p Problem) String() string {
+	return p.Instruction + ": " + p.Message
+}
+
+var (
+	// TLB of an instruction is its tag followed by fields, e.g. `#10 i: (## 4) { 1 <= i } j: (## 4)`
+	tlbRe = regexp.MustCompile(`^#([0-9a-fA-F]+)\s*(.*)$`)
+	// Field types: `(## 4)`, `int8`, `^Cell` or an expression of variable length in parentheses
+	tlbFieldRe      = regexp.MustCompile(`(\w+):\s*(\(## (\d+)\)|u?int(\d+)|\^Cell|\((?:[^()]|\([^()]*\))*\))`)
+	tlbConstraintRe = regexp.MustCompile(`\{[^}]*\}`)
+)
+
+// Validate checks consistency of the specification, which is required by NewRegistry
+// and the decoder, and returns all found problems, nil if the specification is valid:
+//   - opcode ranges are not empty, don't overlap and fit into 24 bits
+//   - Prefix and PrefixStr are the opcode prefix of CheckLen bits, or SkipLen bits for *-range layouts
+//   - SkipLen is CheckLen plus the fixed widths of arguments
+//   - fields of TLB have the same names and widths as arguments
+//   - instruction names and prefixes are unique, related instructions and actual names of Fift instructions exist
+func Validate(tvmSpec Specification) []Problem {
+	var problems []Problem
+	report := func(name, format string, args ...any) {
+		problems = append(problems, Problem{Instruction: name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	names := make(map[string]bool)
+	prefixes := make(map[string]string)
+	for _, instr := range tvmSpec.Instructions {
+		if names[instr.Name] {
+			report(instr.Name, "duplicate instruction name")
+		}
+		names[instr.Name] = true
+		prefix := strings.ToUpper(instr.Layout.PrefixStr)
+		if other, ok := prefixes[prefix]; ok {
+			report(instr.Name, "prefix_str %s is the prefix of %s", prefix, other)
+		}
+		prefixes[prefix] = instr.Name
+	}
+
+	for i := range tvmSpec.Instructions {
+		instr := &tvmSpec.Instructions[i]
+		for _, message := range validateLayout(instr.Layout) {
+			report(instr.Name, "%s", message)
+		}
+		for _, related := range instr.Description.RelatedInstructions {
+			if !names[related] {
+				report(instr.Name, "related instruction %s doesn't exist", related)
+			}
+		}
+	}
+
+	// Ranges are checked in the opcode order, like in opcodeRanges
+	sorted := make([]*Instruction, len(tvmSpec.Instructions))
+	for i := range tvmSpec.Instructions {
+		sorted[i] = &tvmSpec.Instructions[i]
+	}
+	slices.SortStableFunc(sorted, func(a, b *Instruction) int {
+		return int(a.Layout.Min - b.Layout.Min)
+	})
+	var previous *Instruction
+	for _, instr := range sorted {
+		layout := instr.Layout
+		if layout.Min < 0 || layout.Min >= layout.Max || layout.Max > 1<<MaxOpcodeBits {
+			report(instr.Name, "invalid opcode range [%06X, %06X)", layout.Min, layout.Max)
+			continue
+		}
+		if previous != nil && layout.Min < previous.Layout.Max {
+			report(instr.Name, "opcode range [%06X, %06X) overlaps with %s [%06X, %06X)",
+				layout.Min, layout.Max, previous.Name, previous.Layout.Min, previous.Layout.Max)
+		}
+		if previous == nil || layout.Max > previous.Layout.Max {
+			previous = instr
+		}
+	}
+
+	for _, fift := range tvmSpec.FiftInstructions {
+		// Macros don't correspond to any TVM instruction
+		if fift.ActualName != "none" && !names[fift.ActualName] {
+			report(fift.Name, "actual instruction %s of the Fift instruction doesn't exist", fift.ActualName)
+		}
+	}
+	return problems
+}
+
+// validateLayout checks the encoding of a single instruction.
+func validateLayout(layout Layout) []string {
+	var problems []string
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Arguments may exceed 24 bits, e.g. for EXTCALL, while opcode prefixes can't
+	if layout.CheckLen <= 0 || layout.CheckLen > MaxOpcodeBits || layout.SkipLen < layout.CheckLen {
+		report("invalid checkLen %d and skipLen %d", layout.CheckLen, layout.SkipLen)
+		return problems
+	}
+
+	// Opcodes of the range share the prefix of CheckLen bits
+	shift := MaxOpcodeBits - layout.CheckLen
+	tag := layout.Min >> shift
+	if layout.Max > (tag+1)<<shift {
+		report("opcode range [%06X, %06X) exceeds prefix %X of %d bits", layout.Min, layout.Max, tag, layout.CheckLen)
+	}
+
+	// Range layouts encode a part of arguments in the prefix, e.g. SETCP_SHORT
+	prefixLen := layout.CheckLen
+	if layout.Kind == EXTRange || layout.Kind == FixedRange {
+		prefixLen = layout.SkipLen
+	}
+	if prefixLen > MaxOpcodeBits {
+		report("prefix of %d bits exceeds opcode", prefixLen)
+	} else if prefix := layout.Min >> (MaxOpcodeBits - prefixLen); layout.Prefix != prefix {
+		report("prefix %X is not the first %d bits of opcode %06X", layout.Prefix, prefixLen, layout.Min)
+	}
+	if prefixStr := fmt.Sprintf("%X", layout.Prefix); !strings.EqualFold(layout.PrefixStr, prefixStr) {
+		report("prefix_str %s doesn't match prefix %s", layout.PrefixStr, prefixStr)
+	}
+
+	width := layout.CheckLen
+	for _, arg := range layout.Args {
+		w, ok := fixedWidth(arg)
+		if !ok {
+			report("unknown argument kind %s", arg.Empty)
+			return problems
+		}
+		width += w
+	}
+	if layout.SkipLen != width {
+		report("skipLen %d is not checkLen %d plus fixed widths of arguments", layout.SkipLen, layout.CheckLen)
+	}
+
+	return append(problems, validateTLB(layout)...)
+}
+
+// validateTLB checks that the TLB of the instruction describes the same encoding as the layout.
+func validateTLB(layout Layout) []string {
+	m := tlbRe.FindStringSubmatch(layout.Tlb)
+	if m == nil {
+		return []string{fmt.Sprintf("invalid tlb %q", layout.Tlb)}
+	}
+	var problems []string
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if tag, err := strconv.ParseInt(m[1], 16, 64); err != nil || tag != layout.Min>>(MaxOpcodeBits-layout.CheckLen) {
+		report("tlb tag #%s is not the prefix of %d bits", m[1], layout.CheckLen)
+	}
+
+	body := tlbConstraintRe.ReplaceAllString(m[2], "")
+	if rest := strings.TrimSpace(tlbFieldRe.ReplaceAllString(body, "")); rest != "" {
+		report("unexpected %q in tlb %q", rest, layout.Tlb)
+	}
+
+	type field struct {
+		name  string
+		width int64
+		ref   bool
+	}
+	var fields []field
+	var bits, refs int64
+	for _, f := range tlbFieldRe.FindAllStringSubmatch(body, -1) {
+		result := field{name: f[1], width: -1, ref: f[2] == "^Cell"}
+		switch {
+		case f[3] != "":
+			result.width, _ = strconv.ParseInt(f[3], 10, 64)
+		case f[4] != "":
+			result.width, _ = strconv.ParseInt(f[4], 10, 64)
+		case result.ref:
+			result.width = 0
+			refs++
+		}
+		bits += max(result.width, 0)
+		fields = append(fields, result)
+	}
+	if bits != layout.SkipLen-layout.CheckLen {
+		report("tlb %q has %d fixed bits after the tag, expected %d", layout.Tlb, bits, layout.SkipLen-layout.CheckLen)
+	}
+	var argRefs int64
+	for _, arg := range layout.Args {
+		if arg.Empty == RefCodeSlice || arg.Empty == Dict {
+			argRefs++
+		}
+	}
+	if refs != argRefs {
+		report("tlb %q has %d references, arguments have %d", layout.Tlb, refs, argRefs)
+	}
+
+	// Arguments of slices and large integers are described by several fields, the others by one field each
+	for _, arg := range layout.Args {
+		switch arg.Empty {
+		case Slice, CodeSlice, InlineCodeSlice, LargeInt, Debugstr, S1, MinusOne:
+			return problems
+		}
+	}
+	if len(fields) != len(layout.Args) {
+		report("tlb %q has %d fields, expected %d arguments", layout.Tlb, len(fields), len(layout.Args))
+		return problems
+	}
+	for i, arg := range layout.Args {
+		width, _ := fixedWidth(arg)
+		if fields[i].name != arg.Name || fields[i].width != width {
+			report("tlb field %s of %d bits doesn't match argument %s of %d bits", fields[i].name, fields[i].width, arg.Name, width)
+		}
+	}
+	return problems
+}
+
+// fixedWidth returns the number of bits of the argument before its variable-length data,
+// e.g. the length of a slice, false for unknown kinds.
+func fixedWidth(arg Arg) (int64, bool) {
+	switch arg.Empty {
+	case Uint, Int, Stack:
+		if arg.Len == nil {
+			return 0, false
+		}
+		return *arg.Len, true
+	case Delta:
+		if arg.Arg == nil {
+			return 0, false
+		}
+		return fixedWidth(*arg.Arg)
+	case Control, TinyInt, Debugstr:
+		return 4, true
+	case PlduzArg:
+		return 3, true
+	case LargeInt:
+		return 5, true
+	case SetcpArg:
+		return 8, true
+	case RefCodeSlice, Dict, S1, MinusOne, ExoticCell:
+		return 0, true
+	case Slice, CodeSlice:
+		if arg.Refs == nil || arg.Bits == nil {
+			return 0, false
+		}
+		refs, ok1 := fixedWidth(*arg.Refs)
+		bits, ok2 := fixedWidth(*arg.Bits)
+		return refs + bits, ok1 && ok2
+	case InlineCodeSlice:
+		if arg.Bits == nil {
+			return 0, false
+		}
+		return fixedWidth(*arg.Bits)
+	}
+	return 0, false
+}
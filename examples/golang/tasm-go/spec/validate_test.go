@@ -0,0 +1,86 @@
+package spec
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestValidate checks that the embedded specification is valid, and that each inconsistency
+// introduced into it is reported for the right instruction.
+func TestValidate(t *testing.T) {
+	tvmSpec, err := UnmarshalSpecification(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := Validate(tvmSpec); len(problems) != 0 {
+		t.Fatalf("expected valid specification, got %v", problems)
+	}
+
+	// Mutations of a missing instruction don't affect the specification, so the expected problem isn't found
+	byName := func(s *Specification, name string) *Instruction {
+		for i := range s.Instructions {
+			if s.Instructions[i].Name == name {
+				return &s.Instructions[i]
+			}
+		}
+		return &Instruction{}
+	}
+	tests := []struct {
+		name     string
+		mutate   func(s *Specification)
+		expected Problem
+	}{
+		{
+			"duplicate name",
+			func(s *Specification) { byName(s, "SUB").Name = "ADD" },
+			Problem{"ADD", "duplicate instruction name"},
+		},
+		{
+			"duplicate prefix",
+			func(s *Specification) { byName(s, "SUB").Layout.PrefixStr = "a0" },
+			Problem{"SUB", "prefix_str A0 is the prefix of ADD"},
+		},
+		{
+			"unknown related instruction",
+			func(s *Specification) { byName(s, "ADD").Description.RelatedInstructions = []string{"ADDX"} },
+			Problem{"ADD", "related instruction ADDX doesn't exist"},
+		},
+		{
+			"overlapping ranges",
+			func(s *Specification) { byName(s, "ADD").Layout.Max = byName(s, "SUB").Layout.Min + 1 },
+			Problem{"SUB", "opcode range [A10000, A20000) overlaps with ADD [A00000, A10001)"},
+		},
+		{
+			"prefix string",
+			func(s *Specification) { byName(s, "ADD").Layout.PrefixStr = "A1" },
+			Problem{"ADD", "prefix_str A1 doesn't match prefix A0"},
+		},
+		{
+			"skip length",
+			func(s *Specification) { byName(s, "ADD").Layout.SkipLen = 12 },
+			Problem{"ADD", "skipLen 12 is not checkLen 8 plus fixed widths of arguments"},
+		},
+		{
+			"tlb field",
+			func(s *Specification) { byName(s, "ADD").Layout.Tlb = "#a0 i:(## 4)" },
+			Problem{"ADD", `tlb "#a0 i:(## 4)" has 4 fixed bits after the tag, expected 0`},
+		},
+		{
+			"fift alias",
+			func(s *Specification) { s.FiftInstructions[0].ActualName = "ROTREVX" },
+			Problem{tvmSpec.FiftInstructions[0].Name, "actual instruction ROTREVX of the Fift instruction doesn't exist"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mutated, err := UnmarshalSpecification(embedded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.mutate(&mutated)
+			if problems := Validate(mutated); !slices.Contains(problems, test.expected) {
+				t.Errorf("expected problem %q, got %v", test.expected, problems)
+			}
+		})
+	}
+}
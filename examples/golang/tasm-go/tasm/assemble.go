@@ -0,0 +1,806 @@
+package tasm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"slices"
+	"strconv"
+	"tasm-go/spec"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+var (
+	// ErrDoesNotFit is returned when an argument can't be encoded by the instruction layout,
+	// e.g. too long slice or code, or too many references.
+	ErrDoesNotFit = errors.New("argument doesn't fit into instruction")
+	// ErrArgMismatch is returned when an argument has a wrong type for the instruction.
+	ErrArgMismatch = errors.New("argument type mismatch")
+)
+
+// AssembleError describes the instruction that couldn't be assembled.
+type AssembleError struct {
+	// Line in the source text
+	Line int
+	// Name of the instruction as written in the source
+	Instruction string
+	// Underlying error
+	Err error
+}
+
+func (e *AssembleError) Error() string {
+	return fmt.Sprintf("line %d, instruction %s: %s", e.Line, e.Instruction, e.Err)
+}
+
+func (e *AssembleError) Unwrap() error {
+	return e.Err
+}
+
+// encodingFamilies lists instructions which differ only in the size of the argument,
+// ordered from the shortest encoding to the longest one. An instruction from
+// a family is promoted to the next one when its argument doesn't fit.
+var encodingFamilies = [][]string{
+	{"PUSHINT_4", "PUSHINT_8", "PUSHINT_16", "PUSHINT_LONG"},
+	{"PUSHCONT_SHORT", "PUSHCONT", "PUSHREFCONT"},
+	{"PUSHSLICE", "PUSHSLICE_REFS", "PUSHSLICE_LONG"},
+}
+
+// genericNames are not TVM instructions, but denote the shortest suitable encoding in a family.
+var genericNames = map[string]string{
+	"PUSHINT": "PUSHINT_4",
+}
+
+// Assembler encodes textual TASM, as printed by DecompiledCode.String(), back into a code cell.
+// Assembler is immutable after creation and can be shared between goroutines.
+type Assembler struct {
+	decoder *Decoder
+	// Instructions by the original and normalized names
+	byName map[string]*spec.Instruction
+	// Fift aliases of instructions, e.g. FALSE for PUSHINT_4 0
+	aliases map[string]*fiftAlias
+}
+
+// NewAssembler creates an assembler for the given specification.
+func NewAssembler(tvmSpec spec.Specification) (*Assembler, error) {
+	decoder, err := NewDecoder(tvmSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*spec.Instruction)
+	for _, instr := range decoder.registry.Instructions() {
+		byName[instr.Name] = instr
+		byName[normalizeName(instr.Name)] = instr
+	}
+
+	aliases := make(map[string]*fiftAlias)
+	for _, fift := range tvmSpec.FiftInstructions {
+		// Some Fift instructions are macros, which don't correspond to any TVM instruction
+		if fift.ActualName == "none" {
+			continue
+		}
+		alias, err := parseFiftAlias(fift)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := byName[alias.actualName]; !ok {
+			return nil, fmt.Errorf("%w: fift instruction %s refers to unknown instruction %s",
+				ErrInvalidSpecification, alias.name, alias.actualName)
+		}
+		aliases[alias.name] = alias
+	}
+	return &Assembler{decoder: decoder, byName: byName, aliases: aliases}, nil
+}
+
+// Assemble encodes TASM text into a code cell.
+//
+// It builds a new Assembler on every call, use NewAssembler to assemble several sources.
+func Assemble(tvmSpec spec.Specification, text string) (*cell.Cell, error) {
+	a, err := NewAssembler(tvmSpec)
+	if err != nil {
+		return nil, err
+	}
+	return a.Assemble(text)
+}
+
+// Assemble encodes TASM text into a code cell.
+//
+// Instruction names select the exact encoding, e.g. PUSHINT_8 or PUSHCONT, unless
+// the argument doesn't fit, then the next encoding of the same family is used.
+// Generic PUSHINT selects the shortest encoding. Fift aliases of the specification are
+// accepted as well, e.g. FALSE or -ROLL 2. Code that doesn't fit into a cell
+// is moved to a reference, which TVM executes with an implicit jump. Labelled blocks,
+// e.g. `cell_1a2b3c4d: { ... }`, are assembled into a single cell for all references to the label.
+func (a *Assembler) Assemble(text string) (*cell.Cell, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, argCount: a.argCount}
+	code, err := p.parseCode()
+	if err != nil {
+		return nil, err
+	}
+	return a.assembleCell(code)
+}
+
+// argCount returns the number of printed arguments of the instruction.
+func (a *Assembler) argCount(name string) (int, bool) {
+	switch name {
+	case "ref", "UNKNOWN", "TRUNCATED":
+		return 1, true
+	}
+	if generic, ok := genericNames[name]; ok {
+		name = generic
+	}
+	if instr, ok := a.byName[name]; ok {
+		return len(instr.Layout.Args), true
+	}
+	if alias, ok := a.aliases[name]; ok {
+		if alias.args == nil {
+			return len(a.byName[alias.actualName].Layout.Args), true
+		}
+		return alias.argCount, true
+	}
+	return 0, false
+}
+
+// resolveAlias replaces Fift alias with the actual instruction.
+func (a *Assembler) resolveAlias(instr asmInstruction) (asmInstruction, error) {
+	_, generic := genericNames[instr.name]
+	if _, ok := a.byName[instr.name]; ok || generic {
+		return instr, nil
+	}
+	alias, ok := a.aliases[instr.name]
+	if !ok {
+		return instr, nil
+	}
+	args, err := alias.expand(a.byName[alias.actualName], instr.args)
+	if err != nil {
+		return instr, err
+	}
+	instr.name, instr.args = alias.actualName, args
+	return instr, nil
+}
+
+// assembleCell encodes a code block into a separate cell.
+func (a *Assembler) assembleCell(code asmBlock) (*cell.Cell, error) {
+	builder := cell.BeginCell()
+	if err := a.assembleCode(builder, code); err != nil {
+		return nil, err
+	}
+	return builder.EndCell(), nil
+}
+
+// assembleRef encodes the code of a reference: a block or a label, which is assembled once for all its references.
+func (a *Assembler) assembleRef(value any) (*cell.Cell, error) {
+	switch v := value.(type) {
+	case asmBlock:
+		return a.assembleCell(v)
+	case *asmLabel:
+		if v.cell != nil {
+			return v.cell, nil
+		}
+		if v.assembling {
+			return nil, fmt.Errorf("label %s refers to itself", v.name)
+		}
+		v.assembling = true
+		ref, err := a.assembleCell(v.code)
+		v.assembling = false
+		if err != nil {
+			return nil, err
+		}
+		v.cell = ref
+		return ref, nil
+	}
+	return nil, ErrArgMismatch
+}
+
+// assembleCode appends instructions to the builder. If an instruction doesn't fit,
+// it and all the following instructions are moved to a new cell stored as reference.
+func (a *Assembler) assembleCode(builder *cell.Builder, code asmBlock) error {
+	trailingRefs := false
+	for i, instr := range code {
+		fail := func(err error) error {
+			var asmErr *AssembleError
+			if errors.As(err, &asmErr) {
+				return err
+			}
+			return &AssembleError{Line: instr.line, Instruction: instr.name, Err: err}
+		}
+
+		if instr.name == "ref" {
+			ref, err := a.assembleRef(instr.args[0])
+			if err != nil {
+				return fail(err)
+			}
+			if err := builder.StoreRef(ref); err != nil {
+				return fail(err)
+			}
+			trailingRefs = true
+			continue
+		}
+		// References of instructions precede trailing references, otherwise decoding would mix them up
+		if trailingRefs {
+			return fail(errors.New("instruction after ref"))
+		}
+
+		encoded, err := a.encode(instr)
+		if err != nil {
+			return fail(err)
+		}
+		if encoded.BitsUsed() <= builder.BitsLeft() && uint(encoded.RefsUsed()) <= builder.RefsLeft() {
+			builder.MustStoreBuilder(encoded)
+			continue
+		}
+
+		rest, err := a.assembleCell(code[i:])
+		if err != nil {
+			return err
+		}
+		if err := builder.StoreRef(rest); err != nil {
+			return fail(fmt.Errorf("no room for continuation reference: %w", err))
+		}
+		break
+	}
+	return nil
+}
+
+// encode encodes a single instruction, trying the longer encodings of the family if needed.
+func (a *Assembler) encode(instr asmInstruction) (*cell.Builder, error) {
+	if instr.name == "UNKNOWN" || instr.name == "TRUNCATED" {
+		raw, ok := instr.args[0].(Bits)
+		if !ok {
+			return nil, ErrArgMismatch
+		}
+		w := &writer{builder: cell.BeginCell()}
+		w.bits(raw.data, raw.length)
+		return w.builder, w.err
+	}
+
+	instr, err := a.resolveAlias(instr)
+	if err != nil {
+		return nil, err
+	}
+	for key := range instr.hints {
+		if key != "len" && key != "notag" && key != "keylen" {
+			return nil, fmt.Errorf("unknown hint @%s", key)
+		}
+	}
+
+	candidates := a.variants(instr.name)
+	if len(instr.hints) > 0 {
+		// Hints describe the exact encoding, so the instruction isn't promoted
+		candidates = candidates[:1]
+	}
+
+	var firstErr error
+	for _, candidate := range candidates {
+		encoded, err := a.encodeAs(candidate, instr.args, instr.hints, true)
+		if err == nil {
+			return encoded, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !errors.Is(err, ErrDoesNotFit) && !errors.Is(err, ErrValueOutOfRange) {
+			return nil, firstErr
+		}
+	}
+	// Ranges of the specification are narrower than the fields for some instructions,
+	// e.g. RUNVM flags are in [0, 511] but take 12 bits. Such values are decoded as is,
+	// so they are encoded too, if the opcode is decoded back as the same instruction.
+	if errors.Is(firstErr, ErrValueOutOfRange) {
+		if encoded, err := a.encodeAs(candidates[0], instr.args, instr.hints, false); err == nil {
+			return encoded, nil
+		}
+	}
+	return nil, firstErr
+}
+
+// variants returns the instruction and its longer encodings.
+func (a *Assembler) variants(name string) []*spec.Instruction {
+	if generic, ok := genericNames[name]; ok {
+		name = generic
+	}
+	instr := a.byName[name]
+	for _, family := range encodingFamilies {
+		if i := slices.Index(family, instr.Name); i >= 0 {
+			var result []*spec.Instruction
+			for _, variant := range family[i:] {
+				result = append(result, a.byName[variant])
+			}
+			return result
+		}
+	}
+	return []*spec.Instruction{instr}
+}
+
+// encodeAs encodes arguments according to the layout of the instruction,
+// integers and stack registers are checked against the ranges of the specification if checkRanges is set.
+func (a *Assembler) encodeAs(instr *spec.Instruction, args []any, hints map[string]string, checkRanges bool) (*cell.Builder, error) {
+	layout := instr.Layout
+	w := &writer{builder: cell.BeginCell()}
+	// Prefix is the top CheckLen bits of any opcode in the range
+	w.uint(big.NewInt(layout.Min>>(maxOpcodeBits-layout.CheckLen)), uint(layout.CheckLen))
+
+	for i := 0; i < len(layout.Args); i++ {
+		child := layout.Args[i]
+		// Dictionary is paired with its key length uint(10), the next argument,
+		// they are printed as `key_len dict`
+		if child.Empty == "dict" {
+			if err := a.encodeDict(w, args[i], args[i+1]); err != nil {
+				return nil, fmt.Errorf("arg %s: %w", child.Empty, err)
+			}
+			i++
+			continue
+		}
+		if err := a.encodeArg(w, child, args[i], hints, checkRanges); err != nil {
+			return nil, fmt.Errorf("arg %s: %w", child.Empty, err)
+		}
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	// Arg ranges of the specification don't cover all restrictions,
+	// so check that the opcode is decoded back as the same instruction
+	builder := w.builder
+	opcodeLen := min(builder.BitsUsed(), maxOpcodeBits)
+	opcode := builder.ToSlice().MustLoadUInt(opcodeLen) << (maxOpcodeBits - opcodeLen)
+	if a.decoder.registry.ByOpcode(opcode, maxOpcodeBits) != instr {
+		return nil, fmt.Errorf("%w: opcode %s is not %s", ErrValueOutOfRange, formatOpcode(opcode, opcodeLen), instr.Name)
+	}
+	return builder, nil
+}
+
+// encodeDict encodes DICTPUSHCONST-like dictionary with its key length.
+func (a *Assembler) encodeDict(w *writer, keyLengthArg, dictArg any) error {
+	keyLength, ok1 := keyLengthArg.(*big.Int)
+	dict, ok2 := dictArg.(asmDict)
+	if !ok1 || !ok2 {
+		return ErrArgMismatch
+	}
+	w.uint(keyLength, 10)
+	if w.err != nil {
+		return w.err
+	}
+	dictCell, err := a.assembleDict(dict, int(keyLength.Int64()))
+	if err != nil {
+		return err
+	}
+	w.ref(dictCell)
+	return nil
+}
+
+// encodeArg encodes a single argument, hints are applied to slices and large integers.
+func (a *Assembler) encodeArg(w *writer, arg spec.Arg, value any, hints map[string]string, checkRanges bool) error {
+	switch arg.Empty {
+	case "delta":
+		switch arg.Arg.Empty {
+		case "uint", "int":
+			v, ok := value.(*big.Int)
+			if !ok {
+				return ErrArgMismatch
+			}
+			return a.encodeArg(w, *arg.Arg, new(big.Int).Sub(v, big.NewInt(*arg.Delta)), hints, checkRanges)
+		case "stack":
+			v, ok := value.(StackRegister)
+			if !ok {
+				return ErrArgMismatch
+			}
+			return a.encodeArg(w, *arg.Arg, StackRegister{idx: v.idx - *arg.Delta}, hints, checkRanges)
+		}
+		return ErrUnsupportedArg
+	case "int", "uint":
+		v, ok := value.(*big.Int)
+		if !ok {
+			return ErrArgMismatch
+		}
+		if checkRanges {
+			if err := checkRange(arg, v); err != nil {
+				return err
+			}
+		}
+		if arg.Empty == "int" {
+			w.int(v, uint(*arg.Len))
+		} else {
+			w.uint(v, uint(*arg.Len))
+		}
+	case "tinyInt":
+		v, ok := value.(*big.Int)
+		if !ok {
+			return ErrArgMismatch
+		}
+		if err := checkRange(arg, v); err != nil {
+			return err
+		}
+		w.uint(big.NewInt(v.Int64()&15), 4)
+	case "largeInt":
+		v, ok := value.(*big.Int)
+		if !ok {
+			return ErrArgMismatch
+		}
+		// Choose the shortest length 8 * y + 19 bits which fits the value, unless it's specified
+		y := largeIntLength(v)
+		if hint, ok := hints["len"]; ok {
+			length, err := strconv.ParseUint(hint, 10, 5)
+			if err != nil {
+				return fmt.Errorf("invalid hint @len=%s: %w", hint, err)
+			}
+			y = length
+		}
+		w.uint(new(big.Int).SetUint64(y), 5)
+		w.int(v, uint(8*y+19))
+	case "plduzArg":
+		v, ok := value.(*big.Int)
+		if !ok {
+			return ErrArgMismatch
+		}
+		if v.Int64()%32 != 0 {
+			return ErrValueOutOfRange
+		}
+		w.uint(big.NewInt(v.Int64()/32-1), 3)
+	case "control":
+		v, ok := value.(Control)
+		if !ok {
+			return ErrArgMismatch
+		}
+		w.uint(new(big.Int).SetUint64(v.idx), 4)
+	case "stack":
+		v, ok := value.(StackRegister)
+		if !ok {
+			return ErrArgMismatch
+		}
+		idx := big.NewInt(v.idx)
+		if checkRanges {
+			if err := checkRange(arg, idx); err != nil {
+				return err
+			}
+		}
+		w.uint(idx, uint(*arg.Len))
+	case "s1":
+		if v, ok := value.(StackRegister); !ok || v.idx != 1 {
+			return ErrArgMismatch
+		}
+	case "minusOne":
+		if v, ok := value.(*big.Int); !ok || v.Int64() != -1 {
+			return ErrArgMismatch
+		}
+	case "refCodeSlice":
+		if dict, ok := value.(asmDict); ok {
+			// Dictionary of a dispatch table, see Decoder.dispatchFollows
+			keyLength, err := strconv.ParseUint(hints["keylen"], 10, 10)
+			if err != nil {
+				return fmt.Errorf("invalid hint @keylen=%s: %w", hints["keylen"], err)
+			}
+			ref, err := a.assembleDict(dict, int(keyLength))
+			if err != nil {
+				return err
+			}
+			w.ref(ref)
+			break
+		}
+		ref, err := a.assembleRef(value)
+		if err != nil {
+			return err
+		}
+		w.ref(ref)
+	case "inlineCodeSlice", "codeSlice":
+		block, ok := value.(asmBlock)
+		if !ok {
+			return ErrArgMismatch
+		}
+		code := cell.BeginCell()
+		if err := a.assembleCode(code, block); err != nil {
+			return err
+		}
+		if code.BitsUsed()%8 != 0 {
+			return fmt.Errorf("%w: inline code must have whole number of bytes", ErrDoesNotFit)
+		}
+		if arg.Empty == "inlineCodeSlice" && code.RefsUsed() > 0 {
+			return fmt.Errorf("%w: inline code can't have references", ErrDoesNotFit)
+		}
+		if arg.Refs != nil {
+			if err := fitsInto(code.RefsUsed(), *arg.Refs.Len); err != nil {
+				return err
+			}
+			w.uint(big.NewInt(int64(code.RefsUsed())), uint(*arg.Refs.Len))
+		}
+		if err := fitsInto(int(code.BitsUsed()/8), *arg.Bits.Len); err != nil {
+			return err
+		}
+		w.uint(big.NewInt(int64(code.BitsUsed()/8)), uint(*arg.Bits.Len))
+		if w.err == nil {
+			w.err = w.builder.StoreBuilder(code)
+		}
+	case "slice":
+		data, ok := value.(*cell.Cell)
+		if !ok {
+			return ErrArgMismatch
+		}
+		storeSlice(w, arg, data, hints)
+	case "debugstr":
+		data, ok := value.(*cell.Cell)
+		if !ok {
+			return ErrArgMismatch
+		}
+		length := data.BitsSize()
+		if length%8 != 0 || length == 0 || length > 16*8 || data.RefsNum() > 0 {
+			return fmt.Errorf("%w: debug string must have from 1 to 16 bytes", ErrDoesNotFit)
+		}
+		w.uint(big.NewInt(int64(length/8-1)), 4)
+		if w.err == nil {
+			w.err = w.builder.StoreBuilder(data.ToBuilder())
+		}
+	default:
+		return ErrUnsupportedArg
+	}
+	return w.err
+}
+
+// storeSlice stores slice with the number of references, the length in bytes
+// and the data followed by completion tag. Counterpart of loadSlice.
+//
+// Non-canonical encodings are described by hints: @len=y sets the length in bytes,
+// @notag omits completion tag, so the data is all zeros.
+func storeSlice(w *writer, arg spec.Arg, data *cell.Cell, hints map[string]string) {
+	refsArg := *arg.Refs
+	refsDelta := int64(0)
+	if refsArg.Empty == "delta" {
+		refsDelta = *refsArg.Delta
+		refsArg = *refsArg.Arg
+	}
+	countRefs := int64(data.RefsNum()) - refsDelta
+	if countRefs < 0 {
+		w.err = fmt.Errorf("%w: slice must have at least %d references", ErrDoesNotFit, refsDelta)
+		return
+	}
+	if err := fitsInto(int(countRefs), *refsArg.Len); err != nil {
+		w.err = err
+		return
+	}
+	if *refsArg.Len != 0 {
+		w.uint(big.NewInt(countRefs), uint(*refsArg.Len))
+	}
+
+	// Data, completion tag and padding take 8 * y + pad bits
+	length := int64(data.BitsSize())
+	_, noTag := hints["notag"]
+	if noTag && length != 0 {
+		w.err = fmt.Errorf("%w: slice without completion tag must be empty", ErrArgMismatch)
+		return
+	}
+	tagLength := int64(1)
+	if noTag {
+		tagLength = 0
+	}
+	y := max(0, (length+tagLength-*arg.Pad+7)/8)
+	if hint, ok := hints["len"]; ok {
+		v, err := strconv.ParseInt(hint, 10, 64)
+		if err != nil || v < y {
+			w.err = fmt.Errorf("%w: invalid hint @len=%s", ErrArgMismatch, hint)
+			return
+		}
+		y = v
+	}
+	if err := fitsInto(int(y), *arg.Bits.Len); err != nil {
+		w.err = err
+		return
+	}
+	w.uint(big.NewInt(y), uint(*arg.Bits.Len))
+
+	slice := data.BeginParse()
+	w.bits(slice.MustLoadSlice(uint(length)), uint(length))
+	w.uint(big.NewInt(tagLength), uint(tagLength))
+	w.uint(big.NewInt(0), uint(8*y+*arg.Pad-length-tagLength))
+	for i := 0; i < int(data.RefsNum()); i++ {
+		w.ref(slice.MustLoadRef().MustToCell())
+	}
+}
+
+// fitsInto checks that a length fits into the length field of the given size.
+func fitsInto(value int, bits int64) error {
+	if value >= 1<<bits {
+		return fmt.Errorf("%w: %d doesn't fit into %d bits", ErrDoesNotFit, value, bits)
+	}
+	return nil
+}
+
+// checkRange checks value against the range of the argument from specification.
+func checkRange(arg spec.Arg, v *big.Int) error {
+	if arg.Range == nil {
+		return nil
+	}
+	lo, ok1 := new(big.Int).SetString(arg.Range.Min, 10)
+	hi, ok2 := new(big.Int).SetString(arg.Range.Max, 10)
+	if ok1 && ok2 && (v.Cmp(lo) < 0 || v.Cmp(hi) > 0) {
+		return fmt.Errorf("%w: %s is not in [%s, %s]", ErrValueOutOfRange, v, lo, hi)
+	}
+	return nil
+}
+
+// largeIntLength returns the shortest length field y for PUSHINT_LONG,
+// such that the value fits into 8 * y + 19 bits.
+func largeIntLength(v *big.Int) uint64 {
+	bitLen := v.BitLen() + 1
+	if v.Sign() < 0 {
+		bitLen = new(big.Int).Not(v).BitLen() + 1
+	}
+	return uint64(max(0, (bitLen-19+7)/8))
+}
+
+// assembleDict builds a hashmap of methods with keyLength-bit keys, or a prefix dictionary
+// with keys of at most keyLength bits.
+func (a *Assembler) assembleDict(dict asmDict, keyLength int) (*cell.Cell, error) {
+	if len(dict) == 0 {
+		return nil, errors.New("empty dictionary")
+	}
+	if dict[0].prefix != nil {
+		return a.assemblePrefixDict(dict, keyLength)
+	}
+
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(keyLength))
+	entries := make([]dictEntry, 0, len(dict))
+	for _, method := range dict {
+		// Negative keys are stored in two's complement
+		key := new(big.Int).Mod(method.id, modulus)
+		if method.id.Cmp(modulus) >= 0 || new(big.Int).Neg(method.id).Cmp(modulus) > 0 {
+			return nil, fmt.Errorf("%w: method id %s doesn't fit into %d bits", ErrValueOutOfRange, method.id, keyLength)
+		}
+		bitsOfKey := make([]byte, keyLength)
+		for i := range keyLength {
+			bitsOfKey[i] = byte(key.Bit(keyLength - 1 - i))
+		}
+		entries = append(entries, dictEntry{key: bitsOfKey, code: method.code})
+	}
+	slices.SortFunc(entries, func(x, y dictEntry) int { return slices.Compare(x.key, y.key) })
+	for i := 1; i < len(entries); i++ {
+		if slices.Equal(entries[i-1].key, entries[i].key) {
+			return nil, fmt.Errorf("duplicate method id in dictionary")
+		}
+	}
+
+	return a.assembleDictNode(entries, keyLength)
+}
+
+// assemblePrefixDict builds a prefix dictionary, keys must be a prefix code:
+// none of them is a prefix of another one.
+func (a *Assembler) assemblePrefixDict(dict asmDict, keyLength int) (*cell.Cell, error) {
+	entries := make([]dictEntry, 0, len(dict))
+	for _, method := range dict {
+		if int(method.prefix.length) > keyLength {
+			return nil, fmt.Errorf("%w: prefix %s is longer than %d bits", ErrValueOutOfRange, method.prefix.Binary(), keyLength)
+		}
+		entries = append(entries, dictEntry{key: method.prefix.unpack(), code: method.code})
+	}
+	slices.SortFunc(entries, func(x, y dictEntry) int { return slices.Compare(x.key, y.key) })
+	for i := 1; i < len(entries); i++ {
+		if previous := entries[i-1].key; len(previous) <= len(entries[i].key) && slices.Equal(previous, entries[i].key[:len(previous)]) {
+			return nil, fmt.Errorf("prefix %s of another key in dictionary", newBits(previous).Binary())
+		}
+	}
+	return a.assemblePrefixDictNode(entries, keyLength)
+}
+
+// assemblePrefixDictNode builds a prefix dictionary node for entries sorted by keys, like assembleDictNode.
+func (a *Assembler) assemblePrefixDictNode(entries []dictEntry, keyLength int) (*cell.Cell, error) {
+	label := entries[0].key
+	for _, entry := range entries[1:] {
+		common := 0
+		for common < len(label) && common < len(entry.key) && label[common] == entry.key[common] {
+			common++
+		}
+		label = label[:common]
+	}
+
+	w := &writer{builder: cell.BeginCell()}
+	storeLabel(w, label, keyLength)
+	if len(entries) == 1 {
+		// Leaf, the value follows the tag
+		w.uint(big.NewInt(0), 1)
+		if w.err != nil {
+			return nil, w.err
+		}
+		if err := a.assembleCode(w.builder, entries[0].code); err != nil {
+			return nil, err
+		}
+		return w.builder.EndCell(), nil
+	}
+
+	// Fork, keys are split by the next bit after label
+	w.uint(big.NewInt(1), 1)
+	split := slices.IndexFunc(entries, func(e dictEntry) bool { return e.key[len(label)] == 1 })
+	for _, part := range [][]dictEntry{entries[:split], entries[split:]} {
+		children := make([]dictEntry, len(part))
+		for i, entry := range part {
+			children[i] = dictEntry{key: entry.key[len(label)+1:], code: entry.code}
+		}
+		child, err := a.assemblePrefixDictNode(children, keyLength-len(label)-1)
+		if err != nil {
+			return nil, err
+		}
+		w.ref(child)
+	}
+	return w.builder.EndCell(), w.err
+}
+
+type dictEntry struct {
+	key  []byte // remaining bits of the key, one bit per byte
+	code asmBlock
+}
+
+// assembleDictNode builds a hashmap node for entries sorted by keys, the same way as TVM does.
+func (a *Assembler) assembleDictNode(entries []dictEntry, keyLength int) (*cell.Cell, error) {
+	// The label is the longest common prefix of the keys
+	label := entries[0].key
+	for _, entry := range entries[1:] {
+		common := 0
+		for common < len(label) && label[common] == entry.key[common] {
+			common++
+		}
+		label = label[:common]
+	}
+
+	w := &writer{builder: cell.BeginCell()}
+	storeLabel(w, label, keyLength)
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	if len(label) == keyLength {
+		// Leaf, the method code is stored right after the label
+		if err := a.assembleCode(w.builder, entries[0].code); err != nil {
+			return nil, err
+		}
+		return w.builder.EndCell(), nil
+	}
+
+	// Fork, keys are split by the next bit after label
+	split := slices.IndexFunc(entries, func(e dictEntry) bool { return e.key[len(label)] == 1 })
+	for _, part := range [][]dictEntry{entries[:split], entries[split:]} {
+		children := make([]dictEntry, len(part))
+		for i, entry := range part {
+			children[i] = dictEntry{key: entry.key[len(label)+1:], code: entry.code}
+		}
+		child, err := a.assembleDictNode(children, keyLength-len(label)-1)
+		if err != nil {
+			return nil, err
+		}
+		w.ref(child)
+	}
+	return w.builder.EndCell(), w.err
+}
+
+// storeLabel stores hashmap label in the shortest form, the same as TVM does:
+//
+//	hml_short$0 len:(Unary ~n) s:(n * Bit)
+//	hml_long$10 n:(#<= m) s:(n * Bit)
+//	hml_same$11 v:Bit n:(#<= m)
+func storeLabel(w *writer, label []byte, maxLength int) {
+	n := len(label)
+	k := bits.Len(uint(maxLength))
+	same := n > 0 && !slices.Contains(label, 1-label[0])
+
+	switch {
+	case same && n > 1 && k < 2*n-1:
+		w.uint(big.NewInt(int64(6+label[0])), 3)
+		w.uint(big.NewInt(int64(n)), uint(k))
+		return
+	case k < n:
+		w.uint(big.NewInt(2), 2)
+		w.uint(big.NewInt(int64(n)), uint(k))
+	default:
+		// Unary encoding of n: n ones followed by zero
+		w.uint(big.NewInt(0), 1)
+		for range n {
+			w.uint(big.NewInt(1), 1)
+		}
+		w.uint(big.NewInt(0), 1)
+	}
+	for _, bit := range label {
+		w.uint(big.NewInt(int64(bit)), 1)
+	}
+}
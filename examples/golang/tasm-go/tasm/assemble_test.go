@@ -0,0 +1,128 @@
+package tasm
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"tasm-go/spec"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// TestAssembleOutOfSpecRange checks values which fit the field but not the range of the specification:
+// the decoder prints them as is, so the assembler encodes them back, and still promotes in-range values.
+func TestAssembleOutOfSpecRange(t *testing.T) {
+	tvmSpec := spec.Default()
+	// RUNVM 1642, flags are 12 bits long but in [0, 511] by the specification
+	code := cell.BeginCell().MustStoreUInt(0xdb4, 12).MustStoreUInt(1642, 12).EndCell()
+	decompiled, err := DecompileCell(tvmSpec, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := decompiled.String(); text != "RUNVM 1642\n" {
+		t.Fatalf("unexpected decompiled code %q", text)
+	}
+	if err := RoundTrip(tvmSpec, code); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := Assemble(tvmSpec, "RUNVM 4096"); !errors.Is(err, ErrValueOutOfRange) {
+		t.Errorf("expected value out of range for RUNVM 4096, got %v", err)
+	}
+
+	// PUSHINT_4 is in [-5, 10], so 11 is promoted to PUSHINT_8 rather than wrapped
+	promoted, err := Assemble(tvmSpec, "PUSHINT_4 11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := cell.BeginCell().MustStoreUInt(0x800b, 16).EndCell(); string(promoted.Hash()) != string(expected.Hash()) {
+		t.Errorf("expected PUSHINT_8 11, got %s", promoted.Dump())
+	}
+}
+
+// TestAssembleDecompiled checks that the printed code, including non-canonical encodings
+// described by hints, is assembled back into the same cell.
+func TestAssembleDecompiled(t *testing.T) {
+	nop := cell.BeginCell().MustStoreUInt(0x00, 8).EndCell()
+	dict := cell.NewDict(19)
+	if err := dict.SetIntKey(big.NewInt(0), cell.BeginCell().MustStoreUInt(0xa4, 8).EndCell()); err != nil {
+		t.Fatal(err)
+	}
+	if err := dict.SetIntKey(big.NewInt(-1), cell.BeginCell().MustStoreUInt(0xa5, 8).EndCell()); err != nil {
+		t.Fatal(err)
+	}
+	// Prefix dictionary { b{01} => INC, b{1} => DEC }: fork with an empty label, then leaves
+	// with labels hml_short 1 and empty
+	prefixDict := cell.BeginCell().MustStoreUInt(0b001, 3).
+		MustStoreRef(cell.BeginCell().MustStoreUInt(0b01010, 5).MustStoreUInt(0xa4, 8).EndCell()).
+		MustStoreRef(cell.BeginCell().MustStoreUInt(0b000, 3).MustStoreUInt(0xa5, 8).EndCell()).
+		EndCell()
+
+	tests := []struct {
+		name string
+		code *cell.Cell
+		// Fragment of the printed code
+		expected string
+	}{
+		{"jetton minter", loadJetton(t), "SETCP 0"},
+		{
+			// PUSHINT_LONG -7 with 2 bytes more than needed
+			"large int length", cell.BeginCell().MustStoreUInt(0x82, 8).MustStoreUInt(2, 5).MustStoreInt(-7, 35).EndCell(),
+			"PUSHINT_LONG -7 @len=2",
+		},
+		{
+			// PUSHSLICE_SHORT of zero bits only, without the completion tag
+			"slice without tag", cell.BeginCell().MustStoreUInt(0x8b, 8).MustStoreUInt(1, 4).MustStoreUInt(0, 12).EndCell(),
+			"PUSHSLICE 0[] @notag @len=1",
+		},
+		{
+			// PUSHSLICE_SHORT b{10} with a padding byte after the completion tag
+			"slice padding", cell.BeginCell().MustStoreUInt(0x8b, 8).MustStoreUInt(2, 4).MustStoreUInt(0b10100000, 8).MustStoreUInt(0, 12).EndCell(),
+			"PUSHSLICE 2[8_] @len=2",
+		},
+		{
+			"short continuation", cell.BeginCell().MustStoreUInt(0x9, 4).MustStoreUInt(1, 4).MustStoreUInt(0xa4, 8).EndCell(),
+			"PUSHCONT_SHORT {",
+		},
+		{
+			// PUSHCONT with a reference and 1 byte of code
+			"continuation with references", cell.BeginCell().MustStoreUInt(0x47, 7).MustStoreUInt(1, 2).MustStoreUInt(1, 7).MustStoreUInt(0xa4, 8).MustStoreRef(nop).EndCell(),
+			"PUSHCONT {",
+		},
+		{"continuation in reference", cell.BeginCell().MustStoreUInt(0x8a, 8).MustStoreRef(nop).EndCell(), "PUSHREFCONT {"},
+		{
+			"dictionary", cell.BeginCell().MustStoreUInt(0x3d29, 14).MustStoreRef(dict.AsCell()).MustStoreUInt(19, 10).EndCell(),
+			"DICTPUSHCONST 19 [",
+		},
+		{
+			"prefix dictionary", cell.BeginCell().MustStoreUInt(0x3d2b, 14).MustStoreRef(prefixDict).MustStoreUInt(4, 10).EndCell(),
+			"b{01} => {",
+		},
+		{
+			// PUSHREF PUSHINT_8 19 DICTIGETJMP
+			"dispatch table", cell.BeginCell().MustStoreUInt(0x88, 8).MustStoreRef(dict.AsCell()).MustStoreUInt(0x8013, 16).MustStoreUInt(0xf4a0, 16).EndCell(),
+			"@keylen=19",
+		},
+	}
+	tvmSpec := spec.Default()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decompiled, err := DecompileCell(tvmSpec, test.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := decompiled.String()
+			if !strings.Contains(text, test.expected) {
+				t.Fatalf("expected %q in\n%s", test.expected, text)
+			}
+			assembled, err := Assemble(tvmSpec, text)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, text)
+			}
+			if string(assembled.Hash()) != string(test.code.Hash()) {
+				t.Errorf("expected cell %X, got %X\n%s", test.code.Hash(), assembled.Hash(), text)
+			}
+		})
+	}
+}
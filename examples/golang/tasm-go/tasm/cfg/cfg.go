@@ -0,0 +1,466 @@
+// Package cfg builds the control flow graph of the disassembled code.
+//
+// Basic blocks are straight-line sequences of instructions. A block ends with an instruction
+// which has ControlFlow in the specification, e.g. IFJMP or CALLREF, with an exception
+// or at the end of the cell. Continuations are followed when they are known statically:
+// code in arguments, e.g. of IFREF, continuations pushed right before the instruction,
+// e.g. `PUSHCONT { ... } IF`, implicit jumps to references and CALLDICT into the methods
+// of the dictionary pushed by the code with DICTPUSHCONST. Other targets are the Unknown block.
+package cfg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"tasm-go/spec"
+	"tasm-go/tasm"
+)
+
+// BlockKind distinguishes code blocks from the terminal blocks of the graph.
+type BlockKind string
+
+const (
+	// Instructions of the code
+	Code BlockKind = "code"
+	// Return from the code, e.g. RET of a method or the end of the code
+	Exit BlockKind = "exit"
+	// Exception not caught inside the graph
+	Throw BlockKind = "throw"
+	// Continuation which isn't known statically, e.g. EXECUTE of a continuation loaded from data,
+	// or which isn't built since the graph has MaxBlocks blocks
+	Unknown BlockKind = "unknown"
+)
+
+// MaxBlocks limits the number of blocks of the graph. A cell referenced several times has blocks
+// for every return target, e.g. calls of the cell from different blocks, so the number of blocks
+// may grow exponentially with the depth of the code.
+const MaxBlocks = 1 << 16
+
+// EdgeKind labels transitions between blocks.
+type EdgeKind string
+
+const (
+	// Execution continues with the next block, e.g. after a call of an unknown continuation
+	Next EdgeKind = "next"
+	// Condition of IF-like instructions and loops holds, or a key of DICTIGETJMP is found
+	True EdgeKind = "true"
+	// Condition doesn't hold
+	False EdgeKind = "false"
+	// Jump without return, e.g. JMPREF or the implicit jump to the reference of a cell
+	Jump EdgeKind = "jump"
+	// Call with return to the next block, e.g. CALLREF
+	Call EdgeKind = "call"
+	// Return to the continuation in c0
+	Return EdgeKind = "return"
+	// Iteration of REPEAT, WHILE, UNTIL and AGAIN loops
+	Loop EdgeKind = "loop"
+	// Exception, e.g. THROWIF or the handler of TRY
+	ThrowEdge EdgeKind = "throw"
+)
+
+// Graph is the control flow graph of the code.
+type Graph struct {
+	// All blocks in the order of creation, the index of a block is its ID
+	Blocks []*Block
+	// The first block of the code
+	Entry *Block
+	// Methods of the dictionary pushed by the code, called by CALLDICT
+	Methods []*Method
+	// Terminal blocks shared by all code
+	Exit    *Block
+	Throw   *Block
+	Unknown *Block
+}
+
+// Method is a method of the dictionary, e.g. a get method.
+type Method struct {
+	// Key of the method in the dictionary
+	ID    int64
+	Entry *Block
+}
+
+// Block is a basic block.
+type Block struct {
+	// Index of the block in Graph.Blocks
+	ID   int
+	Kind BlockKind
+	// Method containing the block, nil for the code outside of methods and terminal blocks
+	Method       *Method
+	Instructions []tasm.DeserializedInstruction
+	// Outgoing edges
+	Edges []Edge
+}
+
+// Edge is a transition to the next block.
+type Edge struct {
+	To   *Block
+	Kind EdgeKind
+	// Instruction which transfers control, nil for the implicit jump to a reference and
+	// the implicit return at the end of the code
+	Instruction *tasm.DeserializedInstruction
+}
+
+// Build builds the graph of the code. Blocks of a cell referenced several times are shared
+// by the paths which return to the same blocks, e.g. jumps to the cell. Continuations reached
+// after the graph has MaxBlocks blocks aren't built, they are the Unknown block.
+func Build(code tasm.DecompiledCode) *Graph {
+	b := &builder{g: &Graph{}, cells: make(map[cellKey]*Block)}
+	b.g.Exit = b.newBlock(Exit)
+	b.g.Throw = b.newBlock(Throw)
+	b.g.Unknown = b.newBlock(Unknown)
+
+	// Methods are created before the code, so that CALLDICT finds them
+	var methods []tasm.DecompiledMethod
+	for _, instruction := range code.Instructions() {
+		for _, arg := range instruction.Args() {
+			// Entries of prefix dictionaries aren't methods, CALLDICT doesn't call them
+			if dict, ok := arg.(tasm.DecompiledDict); ok && !dict.Prefix() {
+				methods = append(methods, dict.Methods()...)
+			}
+		}
+	}
+	for _, method := range methods {
+		m := &Method{ID: method.ID()}
+		b.method = m
+		m.Entry = b.newBlock(Code)
+		b.g.Methods = append(b.g.Methods, m)
+	}
+	for i, method := range methods {
+		b.method = b.g.Methods[i]
+		b.fill(b.g.Methods[i].Entry, method.Instructions(), []target{{b.g.Exit, Return}})
+	}
+
+	b.method = nil
+	b.g.Entry = b.newBlock(Code)
+	b.fill(b.g.Entry, code.Instructions(), []target{{b.g.Exit, Return}})
+	return b.g
+}
+
+// MethodByID returns the method with the given key, nil if there is no such method.
+func (g *Graph) MethodByID(id int64) *Method {
+	for _, method := range g.Methods {
+		if method.ID == id {
+			return method
+		}
+	}
+	return nil
+}
+
+type builder struct {
+	g *Graph
+	// Method of the new blocks
+	method *Method
+	// Entries of the built cells
+	cells map[cellKey]*Block
+}
+
+// cellKey identifies blocks of a cell, which are the same for the same return targets.
+type cellKey struct {
+	hash    string
+	method  *Method
+	targets string
+}
+
+// target is a block which the code returns to, with the label of the return edge.
+type target struct {
+	block *Block
+	kind  EdgeKind
+}
+
+// targetsKey identifies the targets by IDs of their blocks, e.g. `5 return`.
+func targetsKey(targets []target) string {
+	parts := make([]string, len(targets))
+	for i, t := range targets {
+		parts[i] = fmt.Sprintf("%d %s", t.block.ID, t.kind)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (b *builder) newBlock(kind BlockKind) *Block {
+	block := &Block{ID: len(b.g.Blocks), Kind: kind}
+	if kind == Code {
+		block.Method = b.method
+	}
+	b.g.Blocks = append(b.g.Blocks, block)
+	return block
+}
+
+// addEdge adds the edge unless the block already has an edge of the kind to the same block,
+// e.g. both branches of IFELSE call unknown continuations and continue with the next block.
+func (block *Block) addEdge(to *Block, kind EdgeKind, instruction *tasm.DeserializedInstruction) {
+	for _, edge := range block.Edges {
+		if edge.To == to && edge.Kind == kind {
+			return
+		}
+	}
+	block.Edges = append(block.Edges, Edge{To: to, Kind: kind, Instruction: instruction})
+}
+
+// continueAfter returns the targets of the execution continuing after an instruction: the next block
+// with the edge kind, or the targets of the implicit return if the instruction ends the code.
+func continueAfter(next *Block, kind EdgeKind, returnTo []target) []target {
+	if next != nil {
+		return []target{{next, kind}}
+	}
+	if kind == False {
+		return relabel(returnTo, False)
+	}
+	return returnTo
+}
+
+// relabel returns the targets with the edge kind.
+func relabel(targets []target, kind EdgeKind) []target {
+	result := make([]target, len(targets))
+	for i, t := range targets {
+		result[i] = target{t.block, kind}
+	}
+	return result
+}
+
+// code creates blocks of the code returning to the targets and returns the first one,
+// blocks of referenced cells are reused, see Build.
+func (b *builder) code(code tasm.DecompiledCode, returnTo []target) *Block {
+	if len(b.g.Blocks) >= MaxBlocks {
+		return b.g.Unknown
+	}
+	var key cellKey
+	if hash := code.CellHash(); hash != nil {
+		key = cellKey{string(hash), b.method, targetsKey(returnTo)}
+		if entry, ok := b.cells[key]; ok {
+			return entry
+		}
+	}
+	entry := b.newBlock(Code)
+	if key.hash != "" {
+		b.cells[key] = entry
+	}
+	b.fill(entry, code.Instructions(), returnTo)
+	return entry
+}
+
+// fill adds the instructions to the block, starting new blocks after control flow instructions.
+func (b *builder) fill(block *Block, instructions []tasm.DeserializedInstruction, returnTo []target) {
+	// Continuations pushed by the preceding instructions, nil if the code is unknown
+	var pushed []*tasm.DecompiledCode
+
+	for i := range instructions {
+		instruction := &instructions[i]
+		instr := instruction.Spec()
+		if instruction.Name() == "ref" {
+			// Implicit jump to the first reference, the other references are never executed
+			block.addEdge(b.code(instruction.Args()[0].(tasm.DecompiledCode), returnTo), Jump, nil)
+			return
+		}
+		block.Instructions = append(block.Instructions, *instruction)
+		if instr == nil {
+			// UNKNOWN and TRUNCATED instructions throw
+			block.addEdge(b.g.Throw, ThrowEdge, instruction)
+			return
+		}
+
+		if instr.ControlFlow == nil {
+			switch {
+			case slices.Contains(instr.Effects, spec.EffectAlwaysThrow):
+				block.addEdge(b.g.Throw, ThrowEdge, instruction)
+				return
+			case instr.Category == "exception" && slices.Contains(instr.Effects, spec.EffectCanThrow):
+				// Conditional exceptions, e.g. THROWIF, end the block too
+				next := b.newBlock(Code)
+				block.addEdge(b.g.Throw, ThrowEdge, instruction)
+				block.addEdge(next, Next, instruction)
+				block = next
+				pushed = nil
+			default:
+				if code, ok := instruction.PushedContinuation(); ok {
+					pushed = append(pushed, &code)
+				} else {
+					pushed = nil
+				}
+			}
+			continue
+		}
+
+		continuations := instruction.Continuations(pushed)
+		rest := instructions[i+1:]
+		loop := spec.Loop(instr)
+		// The instruction ending the code continues with the implicit return without an empty block,
+		// unless the rest of the code is the body of the loop
+		var next *Block
+		if len(rest) > 0 || loop != nil && isRestBody(*loop) {
+			next = b.newBlock(Code)
+		}
+		restReturnTo := returnTo
+		if loop != nil {
+			restReturnTo = b.loop(block, next, instruction, *loop, continuations, returnTo)
+		} else {
+			b.branches(block, next, instruction, continuations, returnTo)
+		}
+		if next != nil {
+			b.fill(next, rest, restReturnTo)
+		}
+		return
+	}
+
+	// Implicit RET at the end of the code
+	for _, t := range returnTo {
+		block.addEdge(t.block, t.kind, nil)
+	}
+}
+
+// branches adds edges of ControlFlow.Branches of the instruction, next is nil if the instruction ends the code.
+func (b *builder) branches(block, next *Block, instruction *tasm.DeserializedInstruction, continuations []*tasm.DecompiledCode, returnTo []target) {
+	instr := instruction.Spec()
+	branches := instr.ControlFlow.Branches
+	conditional := spec.IsConditional(instr)
+	toNext := continueAfter(next, Return, returnTo)
+	addEdges := func(targets []target) {
+		for _, t := range targets {
+			block.addEdge(t.block, t.kind, instruction)
+		}
+	}
+
+	for k, branch := range branches {
+		call := spec.IsCall(branch)
+		kind := Jump
+		switch {
+		case conditional || len(branches) == 2 && k == 0:
+			kind = True
+		case len(branches) == 2:
+			kind = False
+		case call:
+			kind = Call
+		}
+
+		switch branch.Type {
+		case spec.PurpleVariable:
+			if k >= len(continuations) || continuations[k] == nil {
+				block.addEdge(b.g.Unknown, kind, instruction)
+				if call {
+					addEdges(continueAfter(next, Next, returnTo))
+				}
+				continue
+			}
+			calleeReturnTo := returnTo
+			if call {
+				calleeReturnTo = toNext
+			}
+			block.addEdge(b.code(*continuations[k], calleeReturnTo), kind, instruction)
+		case spec.TypeRegister:
+			switch index := *branch.Index; {
+			case index == 0 && !call:
+				// RET and IFRET return to the caller
+				for _, t := range returnTo {
+					block.addEdge(t.block, returnKind(kind, t.kind, conditional), instruction)
+				}
+			case index == 3:
+				// CALLDICT and JMPDICT select the method by the argument
+				to := b.g.Unknown
+				if args := instruction.Args(); len(args) > 0 {
+					if id, ok := args[0].(uint64); ok {
+						if method := b.g.MethodByID(int64(id)); method != nil {
+							to = method.Entry
+						}
+					}
+				}
+				block.addEdge(to, kind, instruction)
+				if call {
+					addEdges(continueAfter(next, Next, returnTo))
+				}
+			default:
+				// RETALT returns to c1, which isn't tracked
+				block.addEdge(b.g.Exit, returnKind(kind, Return, conditional), instruction)
+			}
+		}
+	}
+
+	// Continuations without branches are exception handlers, e.g. of TRY, returning to the next block
+	if len(branches) == 1 && len(continuations) > 1 {
+		for _, handler := range continuations[1:] {
+			to := b.g.Unknown
+			if handler != nil {
+				to = b.code(*handler, toNext)
+			}
+			block.addEdge(to, ThrowEdge, instruction)
+		}
+	}
+	if conditional {
+		addEdges(continueAfter(next, False, returnTo))
+	}
+}
+
+// returnKind labels a return edge, conditional returns are labeled by the condition.
+func returnKind(branch, ret EdgeKind, conditional bool) EdgeKind {
+	if conditional {
+		return branch
+	}
+	return ret
+}
+
+// isRestBody reports whether the loop takes the rest of the code as the body, e.g. REPEATEND.
+func isRestBody(loop spec.Continuation) bool {
+	return loop.Args != nil && loop.Args.Body != nil && loop.Args.Body.Type == spec.Cc
+}
+
+// loop adds edges of REPEAT, WHILE, UNTIL and AGAIN loops and returns the targets of the rest
+// of the code. Loops like REPEATEND take the rest of the code, i.e. the next block, as the body
+// and return after the loop. Other loops continue with the next block, nil if the loop ends the code.
+func (b *builder) loop(block, next *Block, instruction *tasm.DeserializedInstruction, loop spec.Continuation, continuations []*tasm.DecompiledCode, returnTo []target) []target {
+	restBody := isRestBody(loop)
+
+	// Entries of the condition of WHILE and of the body, created first since the loop returns to them
+	entries := make([]*Block, len(continuations))
+	for i, code := range continuations {
+		if code == nil || len(b.g.Blocks) >= MaxBlocks {
+			entries[i] = b.g.Unknown
+		} else {
+			entries[i] = b.newBlock(Code)
+		}
+	}
+	if restBody {
+		entries = append(entries, next)
+	}
+	if len(entries) == 0 {
+		block.addEdge(b.g.Unknown, Loop, instruction)
+		return returnTo
+	}
+
+	// After the loop the execution continues with the next block, or returns for the rest-of-code loops
+	after := continueAfter(next, Next, returnTo)
+	if restBody {
+		after = returnTo
+	}
+
+	// Targets of returns from every entry
+	first := entries[0]
+	var returns [][]target
+	switch *loop.Name {
+	case spec.While:
+		// The condition returns to the body or exits, the body returns to the condition
+		if len(entries) == 2 {
+			returns = [][]target{append([]target{{entries[1], True}}, relabel(after, False)...), {{first, Loop}}}
+		}
+	case spec.Until:
+		returns = [][]target{append([]target{{first, Loop}}, relabel(after, True)...)}
+	case spec.Again:
+		returns = [][]target{{{first, Loop}}}
+	default:
+		returns = [][]target{append([]target{{first, Loop}}, after...)}
+	}
+	block.addEdge(first, Loop, instruction)
+	if *loop.Name == spec.Repeat && !restBody {
+		// REPEAT with zero iterations
+		for _, t := range after {
+			block.addEdge(t.block, t.kind, instruction)
+		}
+	}
+
+	for i, code := range continuations {
+		if entries[i] != b.g.Unknown && i < len(returns) {
+			b.fill(entries[i], code.Instructions(), returns[i])
+		}
+	}
+	if restBody && len(returns) == len(entries) {
+		return returns[len(entries)-1]
+	}
+	return returnTo
+}
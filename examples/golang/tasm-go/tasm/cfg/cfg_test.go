@@ -0,0 +1,165 @@
+package cfg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"tasm-go/spec"
+	"tasm-go/tasm"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// build assembles and decompiles the code and builds its graph.
+func build(t *testing.T, text string) *Graph {
+	t.Helper()
+	code, err := tasm.Assemble(spec.Default(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompiled, err := tasm.DecompileCell(spec.Default(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Build(decompiled)
+}
+
+// describe lists the instructions and outgoing edges of code blocks, e.g. `INC; DEC -> return B0`.
+func describe(g *Graph) []string {
+	var result []string
+	for _, block := range g.Blocks {
+		if block.Kind != Code {
+			continue
+		}
+		names := make([]string, len(block.Instructions))
+		for i, instr := range block.Instructions {
+			names[i] = instr.Name()
+		}
+		edges := make([]string, len(block.Edges))
+		for i, edge := range block.Edges {
+			edges[i] = fmt.Sprintf("%s B%d", edge.Kind, edge.To.ID)
+		}
+		result = append(result, fmt.Sprintf("B%d %s -> %s", block.ID, strings.Join(names, "; "), strings.Join(edges, ", ")))
+	}
+	return result
+}
+
+// TestBuild checks blocks and edges of branches, calls, loops, exceptions and implicit jumps.
+// Terminal blocks are B0 exit, B1 throw and B2 unknown.
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{
+			// Both continuations are unknown, the edges to the next block are not repeated,
+			// and the instruction ending the code returns without an empty block
+			"PUSHINT_4 1 PUSHCONT_SHORT { INC } PUSHINT_4 0 IFELSE",
+			[]string{"B3 PUSHINT_4; PUSHCONT_SHORT; PUSHINT_4; IFELSE -> true B2, return B0, false B2"},
+		},
+		{
+			"PUSHINT_4 1 PUSHCONT_SHORT { INC } PUSHCONT_SHORT { DEC } IFELSE INC",
+			[]string{
+				"B3 PUSHINT_4; PUSHCONT_SHORT; PUSHCONT_SHORT; IFELSE -> true B5, false B6",
+				"B4 INC -> return B0",
+				"B5 INC -> return B4",
+				"B6 DEC -> return B4",
+			},
+		},
+		{
+			"PUSHINT_4 1 IFRET INC",
+			[]string{"B3 PUSHINT_4; IFRET -> true B0, false B4", "B4 INC -> return B0"},
+		},
+		{
+			"CALLREF { INC } DEC",
+			[]string{"B3 CALLREF -> call B5", "B4 DEC -> return B0", "B5 INC -> return B4"},
+		},
+		{
+			"INC ref { DEC }",
+			[]string{"B3 INC -> jump B4", "B4 DEC -> return B0"},
+		},
+		{
+			"PUSHINT_4 1 THROWIF_SHORT 5 INC",
+			[]string{"B3 PUSHINT_4; THROWIF_SHORT -> throw B1, next B4", "B4 INC -> return B0"},
+		},
+		{
+			"PUSHINT_4 2 PUSHCONT_SHORT { INC } REPEAT DEC",
+			[]string{"B3 PUSHINT_4; PUSHCONT_SHORT; REPEAT -> loop B5, next B4", "B4 DEC -> return B0", "B5 INC -> loop B5, next B4"},
+		},
+		{
+			"PUSHCONT_SHORT { DUP } PUSHCONT_SHORT { DEC } WHILE",
+			[]string{"B3 PUSHCONT_SHORT; PUSHCONT_SHORT; WHILE -> loop B4", "B4 DUP -> true B5, false B0", "B5 DEC -> loop B4"},
+		},
+	}
+	for _, test := range tests {
+		if blocks := describe(build(t, test.text)); !reflect.DeepEqual(blocks, test.expected) {
+			t.Errorf("%s:\nexpected %q\ngot      %q", test.text, test.expected, blocks)
+		}
+	}
+}
+
+// TestBuildMethods checks that CALLDICT calls the method of the dictionary pushed by the code.
+func TestBuildMethods(t *testing.T) {
+	g := build(t, "DICTPUSHCONST 19 [ 1 => { INC } ] CALLDICT 1 DEC")
+	method := g.MethodByID(1)
+	if method == nil || len(g.Methods) != 1 {
+		t.Fatalf("expected method 1, got %v", g.Methods)
+	}
+	expected := []string{
+		"B3 INC -> return B0",
+		fmt.Sprintf("B4 DICTPUSHCONST; CALLDICT -> call B%d, next B5", method.Entry.ID),
+		"B5 DEC -> return B0",
+	}
+	if blocks := describe(g); !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("expected %q, got %q", expected, blocks)
+	}
+	if g.Entry.ID != 4 || method.Entry.Method != method || g.Entry.Method != nil {
+		t.Errorf("unexpected entries of the code B%d and the method B%d", g.Entry.ID, method.Entry.ID)
+	}
+}
+
+// chain builds n cells of two instructions taking the next cell as the reference, both are the
+// given opcode of 16 bits, so there are 2^n paths through the code.
+func chain(opcode uint64, n int) *cell.Cell {
+	c := cell.BeginCell().MustStoreUInt(0xa4, 8).EndCell() // INC
+	for range n {
+		c = cell.BeginCell().MustStoreUInt(opcode, 16).MustStoreRef(c).MustStoreUInt(opcode, 16).MustStoreRef(c).EndCell()
+	}
+	return c
+}
+
+// TestBuildSharedCells checks that blocks of cells referenced several times are reused
+// for the same return targets, and that the graph is limited by MaxBlocks otherwise.
+func TestBuildSharedCells(t *testing.T) {
+	const depth = 40
+	code, err := tasm.DecompileCell(spec.Default(), chain(0xe302, depth)) // IFJMPREF
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Terminal blocks, two blocks of IFJMPREF in each cell and INC
+	if g := Build(code); len(g.Blocks) != 3+2*depth+1 {
+		t.Errorf("IFJMPREF: expected %d blocks, got %d", 3+2*depth+1, len(g.Blocks))
+	}
+
+	// Calls return to different blocks, so the cell has blocks for each call
+	code, err = tasm.DecompileCell(spec.Default(), chain(0xe300, depth)) // IFREF
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := Build(code)
+	if len(g.Blocks) < MaxBlocks || len(g.Blocks) > MaxBlocks+2*depth {
+		t.Errorf("IFREF: expected about %d blocks, got %d", MaxBlocks, len(g.Blocks))
+	}
+	unknown := 0
+	for _, block := range g.Blocks {
+		for _, edge := range block.Edges {
+			if edge.To == g.Unknown {
+				unknown++
+			}
+		}
+	}
+	if unknown == 0 {
+		t.Error("IFREF: expected calls of the Unknown block")
+	}
+}
@@ -0,0 +1,156 @@
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"tasm-go/tasm"
+)
+
+// ExportDOT writes the graph in the Graphviz DOT language. Blocks are boxes with
+// the instruction listing, methods are clusters and edges are labelled by their kind.
+// Terminal blocks are written only if some edge leads to them.
+func ExportDOT(g *Graph, w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph cfg {")
+	fmt.Fprintln(out, `    node [shape=box fontname="monospace"];`)
+	for _, group := range groups(g) {
+		indent := "    "
+		if group.method != nil {
+			fmt.Fprintf(out, "    subgraph cluster_%s {\n", methodIdentifier(group.method))
+			fmt.Fprintf(out, "        label=%s;\n", dotString(methodTitle(group.method)))
+			indent += "    "
+		}
+		for _, block := range group.blocks {
+			switch block.Kind {
+			case Code:
+				fmt.Fprintf(out, "%sB%d [label=%s];\n", indent, block.ID, dotListing(blockLines(block)))
+			default:
+				fmt.Fprintf(out, "%sB%d [label=%s shape=ellipse];\n", indent, block.ID, dotString(string(block.Kind)))
+			}
+		}
+		if group.method != nil {
+			fmt.Fprintln(out, "    }")
+		}
+	}
+	for _, block := range g.Blocks {
+		for _, edge := range block.Edges {
+			fmt.Fprintf(out, "    B%d -> B%d [label=%s];\n", block.ID, edge.To.ID, dotString(string(edge.Kind)))
+		}
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// ExportMermaid writes the graph as a Mermaid flowchart, see ExportDOT.
+func ExportMermaid(g *Graph, w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "flowchart TD")
+	for _, group := range groups(g) {
+		indent := "    "
+		if group.method != nil {
+			fmt.Fprintf(out, "    subgraph %s [%s]\n", methodIdentifier(group.method), mermaidString(methodTitle(group.method)))
+			indent += "    "
+		}
+		for _, block := range group.blocks {
+			switch block.Kind {
+			case Code:
+				fmt.Fprintf(out, "%sB%d[%s]\n", indent, block.ID, mermaidString(strings.Join(blockLines(block), "\n")))
+			default:
+				fmt.Fprintf(out, "%sB%d([%s])\n", indent, block.ID, mermaidString(string(block.Kind)))
+			}
+		}
+		if group.method != nil {
+			fmt.Fprintln(out, "    end")
+		}
+	}
+	for _, block := range g.Blocks {
+		for _, edge := range block.Edges {
+			fmt.Fprintf(out, "    B%d -->|%s| B%d\n", block.ID, edge.Kind, edge.To.ID)
+		}
+	}
+	return out.Flush()
+}
+
+// group is a cluster of blocks of a method, or the blocks outside of methods.
+type group struct {
+	method *Method
+	blocks []*Block
+}
+
+// groups splits blocks into the code outside of methods, followed by the methods.
+// Terminal blocks without incoming edges are omitted.
+func groups(g *Graph) []group {
+	used := make(map[*Block]bool)
+	for _, block := range g.Blocks {
+		for _, edge := range block.Edges {
+			used[edge.To] = true
+		}
+	}
+	result := []group{{}}
+	index := make(map[*Method]int)
+	for _, method := range g.Methods {
+		index[method] = len(result)
+		result = append(result, group{method: method})
+	}
+	for _, block := range g.Blocks {
+		if block.Kind != Code && !used[block] {
+			continue
+		}
+		i := 0
+		if block.Method != nil {
+			i = index[block.Method]
+		}
+		result[i].blocks = append(result[i].blocks, block)
+	}
+	return result
+}
+
+// methodIdentifier returns the identifier of the method cluster, e.g. `method_n1` for -1.
+func methodIdentifier(method *Method) string {
+	if method.ID < 0 {
+		return fmt.Sprintf("method_n%d", -method.ID)
+	}
+	return fmt.Sprintf("method_%d", method.ID)
+}
+
+func methodTitle(method *Method) string {
+	return fmt.Sprintf("method %d", method.ID)
+}
+
+// blockLines returns the title and the instructions of the block, nested code is collapsed
+// since it's in other blocks.
+func blockLines(block *Block) []string {
+	lines := []string{fmt.Sprintf("B%d", block.ID)}
+	for _, instruction := range block.Instructions {
+		lines = append(lines, instruction.Format(tasm.PrintCollapsed()))
+	}
+	return lines
+}
+
+// dotString quotes the text as a DOT string, newlines are written as \n.
+func dotString(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, `"`, `\"`)
+	return `"` + strings.ReplaceAll(text, "\n", `\n`) + `"`
+}
+
+// dotListing quotes lines as a DOT string, lines are left-justified with \l.
+func dotListing(lines []string) string {
+	builder := strings.Builder{}
+	builder.WriteString(`"`)
+	for _, line := range lines {
+		quoted := dotString(line)
+		builder.WriteString(quoted[1 : len(quoted)-1])
+		builder.WriteString(`\l`)
+	}
+	builder.WriteString(`"`)
+	return builder.String()
+}
+
+// mermaidString quotes the text as a Mermaid label, special characters are written as entities.
+func mermaidString(text string) string {
+	replacer := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "\n", "<br/>")
+	return `"` + replacer.Replace(text) + `"`
+}
@@ -0,0 +1,75 @@
+package cfg
+
+import (
+	"strings"
+	"testing"
+)
+
+// exportCode has a method with a negative ID and an unknown call, the throw block has no edges.
+const exportCode = "DICTPUSHCONST 19 [ -1 => { PUSHCONT_SHORT { INC } IF } ] CALLDICT 1"
+
+// TestExportDOT checks clusters of methods, left-justified listings and omitted terminal blocks.
+func TestExportDOT(t *testing.T) {
+	expected := `digraph cfg {
+    node [shape=box fontname="monospace"];
+    B0 [label="exit" shape=ellipse];
+    B2 [label="unknown" shape=ellipse];
+    B5 [label="B5\lDICTPUSHCONST 19 [ ... ]\lCALLDICT 1\l"];
+    subgraph cluster_method_n1 {
+        label="method -1";
+        B3 [label="B3\lPUSHCONT_SHORT { ... }\lIF\l"];
+        B4 [label="B4\lINC\l"];
+    }
+    B3 -> B4 [label="true"];
+    B3 -> B0 [label="false"];
+    B4 -> B0 [label="return"];
+    B5 -> B2 [label="call"];
+    B5 -> B0 [label="return"];
+}
+`
+	builder := strings.Builder{}
+	if err := ExportDOT(build(t, exportCode), &builder); err != nil {
+		t.Fatal(err)
+	}
+	if builder.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, builder.String())
+	}
+}
+
+// TestExportMermaid checks subgraphs of methods and rounded terminal blocks.
+func TestExportMermaid(t *testing.T) {
+	expected := `flowchart TD
+    B0(["exit"])
+    B2(["unknown"])
+    B5["B5<br/>DICTPUSHCONST 19 [ ... ]<br/>CALLDICT 1"]
+    subgraph method_n1 ["method -1"]
+        B3["B3<br/>PUSHCONT_SHORT { ... }<br/>IF"]
+        B4["B4<br/>INC"]
+    end
+    B3 -->|true| B4
+    B3 -->|false| B0
+    B4 -->|return| B0
+    B5 -->|call| B2
+    B5 -->|return| B0
+`
+	builder := strings.Builder{}
+	if err := ExportMermaid(build(t, exportCode), &builder); err != nil {
+		t.Fatal(err)
+	}
+	if builder.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, builder.String())
+	}
+}
+
+// TestExportQuoting checks escaping of quotes, backslashes and markup in labels.
+func TestExportQuoting(t *testing.T) {
+	if quoted := dotString("a \"b\" \\c\nd"); quoted != `"a \"b\" \\c\nd"` {
+		t.Errorf("unexpected DOT string %s", quoted)
+	}
+	if quoted := dotListing([]string{`x{"}`, "y"}); quoted != `"x{\"}\ly\l"` {
+		t.Errorf("unexpected DOT listing %s", quoted)
+	}
+	if quoted := mermaidString("a \"b\" <c>\nd"); quoted != `"a #quot;b#quot; #lt;c#gt;<br/>d"` {
+		t.Errorf("unexpected Mermaid string %s", quoted)
+	}
+}
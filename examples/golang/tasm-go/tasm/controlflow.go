@@ -0,0 +1,78 @@
+package tasm
+
+import (
+	"slices"
+	"tasm-go/spec"
+)
+
+// PushedContinuation returns the code pushed by PUSHCONT-like instructions, false for other instructions.
+func (d DeserializedInstruction) PushedContinuation() (DecompiledCode, bool) {
+	if d.instr == nil || !spec.PushesContinuation(d.instr) {
+		return DecompiledCode{}, false
+	}
+	for _, arg := range d.args {
+		if code, ok := arg.(DecompiledCode); ok {
+			return code, true
+		}
+	}
+	return DecompiledCode{}, false
+}
+
+// Continuations returns the continuations of the control flow instruction: first code in arguments
+// in the order of the layout, e.g. the body of IFREF, then continuations taken from the stack in the
+// order of the stack inputs, from the deepest one. Else branches and exception handlers are moved
+// after the others, so IFELSE, IFELSEREF and IFREFELSE return the body and then the else branch,
+// and TRY returns the body and then the handler.
+// Continuations from the stack are known only if the preceding instructions pushed them, e.g.
+// `PUSHCONT { ... } IF`: pushed are continuations of the preceding PUSHCONT-like instructions,
+// see PushedContinuation. Unknown continuations are nil.
+func (d DeserializedInstruction) Continuations(pushed []*DecompiledCode) []*DecompiledCode {
+	if d.instr == nil {
+		return nil
+	}
+	type named struct {
+		name string
+		code *DecompiledCode
+	}
+	var result []named
+
+	var codes []DecompiledCode
+	for _, arg := range d.args {
+		if code, ok := arg.(DecompiledCode); ok {
+			codes = append(codes, code)
+		}
+	}
+	for _, arg := range d.instr.Layout.Args {
+		if (arg.Empty == spec.RefCodeSlice || arg.Empty == spec.CodeSlice || arg.Empty == spec.InlineCodeSlice) && len(codes) > 0 {
+			result = append(result, named{arg.Name, &codes[0]})
+			codes = codes[1:]
+		}
+	}
+
+	// The last pushed continuation is the topmost input
+	inputs := spec.ContinuationInputs(d.instr)
+	offset := len(pushed) - len(inputs)
+	for i, name := range inputs {
+		var code *DecompiledCode
+		if offset+i >= 0 {
+			code = pushed[offset+i]
+		}
+		result = append(result, named{name, code})
+	}
+
+	// Bodies precede else branches and exception handlers, which may come from arguments or the stack
+	rank := func(name string) int {
+		if name == "else" || name == "handler" {
+			return 1
+		}
+		return 0
+	}
+	slices.SortStableFunc(result, func(a, b named) int {
+		return rank(a.name) - rank(b.name)
+	})
+	continuations := make([]*DecompiledCode, len(result))
+	for i, c := range result {
+		continuations[i] = c.code
+	}
+	return continuations
+}
@@ -0,0 +1,58 @@
+package tasm
+
+import (
+	"slices"
+	"strings"
+	"tasm-go/spec"
+	"testing"
+)
+
+// TestContinuationsOrder checks that continuations from arguments precede the ones from the stack,
+// and else branches and exception handlers come last.
+func TestContinuationsOrder(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"PUSHINT_4 1 PUSHCONT_SHORT { INC } PUSHCONT_SHORT { DEC } IFELSE", []string{"INC", "DEC"}},
+		// The else branch is an argument, the body is taken from the stack
+		{"PUSHINT_4 1 PUSHCONT_SHORT { INC } IFELSEREF { DEC }", []string{"INC", "DEC"}},
+		{"PUSHINT_4 1 PUSHCONT_SHORT { DEC } IFREFELSE { INC }", []string{"INC", "DEC"}},
+		{"PUSHINT_4 1 IFREFELSEREF { INC } { DEC }", []string{"INC", "DEC"}},
+		{"PUSHCONT_SHORT { INC } PUSHCONT_SHORT { DEC } TRY", []string{"INC", "DEC"}},
+		// The body isn't pushed by the preceding instructions
+		{"PUSHCONT_SHORT { DEC } TRY", []string{"?", "DEC"}},
+		{"PUSHCONT_SHORT { INC } PUSHCONT_SHORT { DEC } WHILE", []string{"INC", "DEC"}},
+	}
+	for _, test := range tests {
+		code, err := Assemble(spec.Default(), test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		decompiled, err := DecompileCell(spec.Default(), code)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+
+		instructions := decompiled.Instructions()
+		var pushed []*DecompiledCode
+		for _, instr := range instructions {
+			if code, ok := instr.PushedContinuation(); ok {
+				pushed = append(pushed, &code)
+			}
+		}
+		var continuations []string
+		for _, code := range instructions[len(instructions)-1].Continuations(pushed) {
+			if code == nil {
+				continuations = append(continuations, "?")
+			} else {
+				continuations = append(continuations, strings.TrimSpace(code.String()))
+			}
+		}
+		if !slices.Equal(continuations, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.text, test.expected, continuations)
+		}
+	}
+}
@@ -0,0 +1,502 @@
+package tasm
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"tasm-go/spec"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// ErrInvalidSpecification is returned by NewDecoder when opcode ranges of the
+// specification are empty, overlap or exceed 24 bits, or names or prefixes of
+// instructions repeat, see spec.NewRegistry.
+var ErrInvalidSpecification = spec.ErrInvalidSpecification
+
+// Decoder decompiles TVM cells according to a particular specification.
+// Decoder is immutable after creation, so a single instance can be shared
+// between goroutines, and decoders for different specifications can be used side by side.
+type Decoder struct {
+	// Index of the specification with opcode ranges
+	registry *spec.Registry
+	// See WithLenient
+	lenient bool
+	// See WithTVMVersion, zero decodes instructions of all versions
+	version int64
+	// See WithMaxCells
+	maxCells int
+	// State of a single DecompileCell call, the shared Decoder has none
+	state *decodeState
+}
+
+// decodeState is the mutable state of decoding a single cell tree.
+type decodeState struct {
+	// Code of the references by cell hash, so that cells shared by several references are decoded once
+	refs map[string]DecompiledCode
+	// Number of decoded cells, see WithMaxCells
+	cells int
+}
+
+// DefaultMaxCells is the default limit of WithMaxCells.
+const DefaultMaxCells = 1 << 16
+
+// Option configures Decoder.
+type Option func(*Decoder)
+
+// WithLenient enables partial recovery mode. Instead of returning an error,
+// the decoder emits an `UNKNOWN x{...}` pseudo-instruction for an invalid opcode
+// or `TRUNCATED x{...}` when instruction doesn't fit into the cell. Both keep the
+// rest of the cell bits as is, and the cell references are still decoded.
+// This is useful for data cells placed among the code, e.g. in PUSHREF.
+func WithLenient() Option {
+	return func(d *Decoder) {
+		d.lenient = true
+	}
+}
+
+// WithTVMVersion targets the TVM global version, e.g. the one of the network config.
+// Instructions introduced in later versions, see Layout.Version, are invalid opcodes for it:
+// the decoder returns ErrUnsupportedVersion, or emits `UNKNOWN x{...}` in lenient mode.
+// By default instructions of all versions are decoded, see RequiredVersion.
+func WithTVMVersion(version int64) Option {
+	return func(d *Decoder) {
+		d.version = version
+	}
+}
+
+// WithMaxCells limits the number of cells decoded by a single DecompileCell call, DefaultMaxCells
+// by default, zero disables the limit. Cells shared by several references are decoded once,
+// but values of dictionaries, inline continuations and other cell parts count separately,
+// so a small DAG of dictionary forks may expand into many of them.
+// The decoder returns ErrTooManyCells when the limit is exceeded, in lenient mode as well.
+func WithMaxCells(n int) Option {
+	return func(d *Decoder) {
+		d.maxCells = n
+	}
+}
+
+// NewDecoder creates a decoder for the given specification.
+func NewDecoder(tvmSpec spec.Specification, opts ...Option) (*Decoder, error) {
+	registry, err := spec.NewRegistry(tvmSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Decoder{registry: registry, maxCells: DefaultMaxCells}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d, nil
+}
+
+// DecompileCell recursively decompiles TVM cell into sequence of instructions.
+// Malformed code doesn't panic, instead *DecodeError is returned.
+//
+// It builds a new Decoder on every call, use NewDecoder to decompile several cells.
+func DecompileCell(tvmSpec spec.Specification, cell *cell.Cell) (DecompiledCode, error) {
+	d, err := NewDecoder(tvmSpec)
+	if err != nil {
+		return DecompiledCode{}, err
+	}
+	return d.DecompileCell(cell)
+}
+
+// DecompileCell recursively decompiles TVM cell into sequence of instructions.
+// Malformed code doesn't panic, instead *DecodeError is returned.
+// Cells referenced several times are decoded once, see DecompiledCode.Format.
+func (d *Decoder) DecompileCell(cell *cell.Cell) (DecompiledCode, error) {
+	return d.session().decompileCell(cell, source{cell: cell})
+}
+
+// session returns a copy of the decoder with its own state, which decodes a single cell tree.
+func (d *Decoder) session() *Decoder {
+	session := *d
+	session.state = &decodeState{refs: make(map[string]DecompiledCode)}
+	return &session
+}
+
+// source is the location of the decoded cell in the original code. Inline continuations
+// and dictionary values are copied into separate cells, while TVM executes them in place.
+type source struct {
+	// Original cell
+	cell *cell.Cell
+	// Offset of the first bit of the decoded cell in the original one
+	bits uint
+	// Index of the first reference of the decoded cell in the original one
+	refs int
+}
+
+// position returns the position of the decoded cell part in the original cell.
+func (s source) position(offset uint, length uint, refs ...int) Position {
+	for i := range refs {
+		refs[i] += s.refs
+	}
+	return Position{CellHash: s.cell.Hash(), Offset: s.bits + offset, Length: length, Refs: refs}
+}
+
+// decompileCell recursively decompiles TVM cell into sequence of instructions.
+func (d *Decoder) decompileCell(cell *cell.Cell, src source) (DecompiledCode, error) {
+	if d.cellsLeft() == 0 {
+		return DecompiledCode{}, fmt.Errorf("%w: more than %d", ErrTooManyCells, d.maxCells)
+	}
+	d.state.cells++
+	slice := cell.BeginParse()
+	result := make([]DeserializedInstruction, 0, 32)
+
+	// Parse all instructions in the current cell
+	for slice.BitsLeft() > 0 {
+		start := slice.Copy()
+		offset := cell.BitsSize() - slice.BitsLeft()
+		firstRef := int(cell.RefsNum()) - slice.RefsNum()
+		instruction, err := d.load(cell, slice, src)
+		if err != nil {
+			if !d.lenient || errors.Is(err, ErrTooManyCells) {
+				return DecompiledCode{}, err
+			}
+			// Rewind to the start of the failed instruction and keep the rest of bits undecoded,
+			// the remaining references are processed below
+			slice = start
+			instruction = undecodedInstruction(slice, err)
+			instruction.pos = src.position(offset, cell.BitsSize()-offset)
+			result = append(result, instruction)
+			break
+		}
+		var refs []int
+		for i := firstRef; i < int(cell.RefsNum())-slice.RefsNum(); i++ {
+			refs = append(refs, i)
+		}
+		instruction.pos = src.position(offset, cell.BitsSize()-slice.BitsLeft()-offset, refs...)
+		result = append(result, instruction)
+	}
+
+	// And recursively process references to other cells
+	for slice.RefsNum() > 0 {
+		index := int(cell.RefsNum()) - slice.RefsNum()
+		ref, err := slice.LoadRefCell()
+		if err != nil {
+			return DecompiledCode{}, err
+		}
+		code, err := d.decompileRef(ref)
+		if err != nil {
+			return DecompiledCode{}, err
+		}
+		// ref is a special pseudo-instruction that denotes a code that placed in reference
+		result = append(result, DeserializedInstruction{
+			name: "ref",
+			args: []any{code},
+			pos:  src.position(cell.BitsSize(), 0, index),
+		})
+	}
+
+	return DecompiledCode{instructions: result}, nil
+}
+
+// cellsLeft returns the number of cells which can be decoded until the limit of WithMaxCells.
+func (d *Decoder) cellsLeft() int {
+	if d.maxCells == 0 {
+		return math.MaxInt
+	}
+	return max(0, d.maxCells-d.state.cells)
+}
+
+// decompileRef decompiles the code in the reference, the cells referenced several times are decoded once.
+func (d *Decoder) decompileRef(ref *cell.Cell) (DecompiledCode, error) {
+	key := string(ref.Hash())
+	if code, ok := d.state.refs[key]; ok {
+		return code, nil
+	}
+	code, err := d.decompileCell(ref, source{cell: ref})
+	if err != nil {
+		return DecompiledCode{}, err
+	}
+	code.hash = ref.Hash()
+	d.state.refs[key] = code
+	return code, nil
+}
+
+// undecodedInstruction creates a pseudo-instruction holding all remaining bits of the slice.
+func undecodedInstruction(slice *cell.Slice, err error) DeserializedInstruction {
+	name := "TRUNCATED"
+	if errors.Is(err, ErrInvalidOpcode) || errors.Is(err, ErrUnsupportedArg) || errors.Is(err, ErrUnsupportedVersion) {
+		name = "UNKNOWN"
+	}
+	length, data, _ := slice.RestBits()
+	return DeserializedInstruction{name: name, args: []any{Bits{data: data, length: length}}}
+}
+
+const maxOpcodeBits = spec.MaxOpcodeBits
+
+// load parses a single TVM instruction from the slice.
+func (d *Decoder) load(c *cell.Cell, slice *cell.Slice, src source) (DeserializedInstruction, error) {
+	offset := src.bits + c.BitsSize() - slice.BitsLeft()
+	// Preload 24 bits of opcode, since opcode can be up to 24 bits
+	bits := min(slice.BitsLeft(), maxOpcodeBits)
+	// If there are less than 24 bits left (last instruction), align the opcode to 24 bits
+	opcode := slice.MustPreloadUInt(bits) << (maxOpcodeBits - bits)
+
+	fail := func(name string, arg spec.Empty, err error) (DeserializedInstruction, error) {
+		// Errors from nested cells already point to the right place
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			return DeserializedInstruction{}, err
+		}
+		return DeserializedInstruction{}, &DecodeError{
+			CellHash:    src.cell.Hash(),
+			Offset:      offset,
+			Opcode:      opcode,
+			OpcodeLen:   bits,
+			Instruction: name,
+			Arg:         arg,
+			Err:         err,
+		}
+	}
+
+	instr := d.registry.ByOpcode(opcode, maxOpcodeBits)
+	if instr == nil {
+		return fail("", "", ErrInvalidOpcode)
+	}
+	layout := instr.Layout
+	name := instr.Name
+	if d.version > 0 && layout.Version != nil && *layout.Version > d.version {
+		return fail(name, "", fmt.Errorf("%w: requires v%d", ErrUnsupportedVersion, *layout.Version))
+	}
+
+	r := &reader{slice: slice}
+	r.uint(uint(layout.CheckLen)) // skip opcode, we already know an instruction
+	if r.err != nil {
+		return fail(name, "", r.err)
+	}
+
+	var args []any
+	var hints []string
+
+	for i := 0; i < len(layout.Args); i++ {
+		child := layout.Args[i]
+		switch child.Empty {
+		case "dict":
+			// Dictionary is paired with its key length uint(10), the next argument,
+			// they are loaded together and printed as `key_len dict`
+			keyLength, dict, err := d.loadDict(r, isPrefixDict(instr))
+			if err != nil {
+				return fail(name, child.Empty, err)
+			}
+			args = append(args, keyLength, dict)
+			i++
+		case "delta":
+			switch child.Arg.Empty {
+			case "uint":
+				// Delta can be negative, e.g. for SETCP_SHORT
+				args = append(args, int64(r.uint(uint(*child.Arg.Len)))+*child.Delta)
+			case "int":
+				args = append(args, r.int(uint(*child.Arg.Len))+*child.Delta)
+			case "stack":
+				args = append(args, StackRegister{idx: int64(r.uint(uint(*child.Arg.Len))) + *child.Delta})
+			default:
+				return fail(name, child.Arg.Empty, ErrUnsupportedArg)
+			}
+		case "int":
+			args = append(args, r.int(uint(*child.Len)))
+		case "uint":
+			args = append(args, r.uint(uint(*child.Len)))
+		case "tinyInt":
+			args = append(args, ((int64(r.uint(4))+5)&15)-5)
+		case "largeInt":
+			y := r.uint(5)
+			v := r.bigInt(uint(3 + ((y&31)+2)*8))
+			if r.err != nil {
+				break
+			}
+			if y != largeIntLength(v) {
+				hints = append(hints, fmt.Sprintf("len=%d", y))
+			}
+			args = append(args, v)
+		case "plduzArg":
+			args = append(args, ((r.uint(3)&7)+1)<<5)
+		case "control":
+			args = append(args, Control{idx: r.uint(4)})
+		case "stack":
+			args = append(args, StackRegister{idx: int64(r.uint(uint(*child.Len)))})
+		case "s1":
+			args = append(args, StackRegister{idx: 1})
+		case "minusOne":
+			args = append(args, int64(-1))
+		case "refCodeSlice":
+			ref := r.ref()
+			if r.err != nil {
+				break
+			}
+			// Constant dictionary of a dispatch table, e.g. `PUSHREF 19 PUSHINT DICTIGETJMP`
+			if keyLength, prefix, ok := d.dispatchFollows(name, r.slice, src, c); ok {
+				dict, err := d.decompileDict(ref, keyLength, prefix)
+				if errors.Is(err, ErrTooManyCells) {
+					return fail(name, child.Empty, err)
+				}
+				if err == nil {
+					args = append(args, dict)
+					hints = append(hints, fmt.Sprintf("keylen=%d", keyLength))
+					break
+				}
+			}
+			code, err := d.decompileRef(ref)
+			if err != nil {
+				return fail(name, child.Empty, err)
+			}
+			args = append(args, code)
+		case "inlineCodeSlice":
+			y := r.uint(uint(*child.Bits.Len))
+			code, err := d.loadCodeSlice(c, r, src, y*8, 0)
+			if err != nil {
+				return fail(name, child.Empty, err)
+			}
+			args = append(args, code)
+		case "codeSlice":
+			countRefs := r.uint(uint(*child.Refs.Len))
+			y := r.uint(uint(*child.Bits.Len))
+			code, err := d.loadCodeSlice(c, r, src, y*8, countRefs)
+			if err != nil {
+				return fail(name, child.Empty, err)
+			}
+			args = append(args, code)
+		case "slice":
+			slice, sliceHints := loadSlice(r, child)
+			args = append(args, slice)
+			hints = append(hints, sliceHints...)
+		case "debugstr":
+			y := r.uint(4)
+			realLength := (y + 1) * 8
+			data := r.bits(uint(realLength))
+			if r.err != nil {
+				break
+			}
+			sliceBuilder := cell.Builder{}
+			sliceBuilder.MustStoreSlice(data, uint(realLength))
+			args = append(args, sliceBuilder.ToSlice())
+		default:
+			return fail(name, child.Empty, ErrUnsupportedArg)
+		}
+		if r.err != nil {
+			return fail(name, child.Empty, r.err)
+		}
+	}
+
+	return DeserializedInstruction{
+		name:  name,
+		instr: instr,
+		args:  args,
+		hints: hints,
+	}, nil
+}
+
+// loadCodeSlice loads inline code of the given length in bits with countRefs
+// references and decompiles it as a separate cell.
+func (d *Decoder) loadCodeSlice(c *cell.Cell, r *reader, src source, bits uint64, countRefs uint64) (DecompiledCode, error) {
+	// Location of the continuation in the original cell
+	src.bits += c.BitsSize() - r.slice.BitsLeft()
+	src.refs += int(c.RefsNum()) - r.slice.RefsNum()
+
+	data := r.bits(uint(bits))
+	if r.err != nil {
+		return DecompiledCode{}, r.err
+	}
+	sliceBuilder := cell.Builder{}
+	sliceBuilder.MustStoreSlice(data, uint(bits))
+	for i := uint64(0); i < countRefs; i++ {
+		ref := r.ref()
+		if r.err != nil {
+			return DecompiledCode{}, r.err
+		}
+		sliceBuilder.MustStoreRef(ref)
+	}
+	return d.decompileCell(sliceBuilder.EndCell(), src)
+}
+
+// isPrefixDict reports whether the dictionary used by the instruction is a prefix one, e.g. of PFXDICTSWITCH.
+func isPrefixDict(instr *spec.Instruction) bool {
+	return strings.HasPrefix(instr.Name, "PFXDICT")
+}
+
+// dispatchFollows checks whether the reference pushed by PUSHREF is the dictionary of the dispatch
+// table which follows it: an integer key length and a jump by the key, e.g. DICTIGETJMP or
+// PFXDICTGETEXEC. It returns the key length and whether the dictionary is a prefix one.
+func (d *Decoder) dispatchFollows(name string, slice *cell.Slice, src source, c *cell.Cell) (uint64, bool, bool) {
+	if name != "PUSHREF" {
+		return 0, false, false
+	}
+	rest := slice.Copy()
+	// Only PUSHINT is loaded, since loading other instructions may decompile their references again
+	peek := func() *spec.Instruction {
+		bits := min(rest.BitsLeft(), maxOpcodeBits)
+		if bits == 0 {
+			return nil
+		}
+		return d.registry.ByOpcode(rest.MustPreloadUInt(bits)<<(maxOpcodeBits-bits), maxOpcodeBits)
+	}
+	if instr := peek(); instr == nil || !strings.HasPrefix(instr.Name, "PUSHINT") {
+		return 0, false, false
+	}
+	pushInt, err := d.load(c, rest, src)
+	if err != nil || len(pushInt.args) != 1 {
+		return 0, false, false
+	}
+	keyLength, ok := argInt(pushInt.args[0])
+	if !ok || keyLength.Sign() < 0 || keyLength.Cmp(big.NewInt(1023)) > 0 {
+		return 0, false, false
+	}
+	jump := peek()
+	if jump == nil || jump.Category != "dictionary" || jump.ControlFlow == nil || len(jump.Layout.Args) > 0 {
+		return 0, false, false
+	}
+	return keyLength.Uint64(), isPrefixDict(jump), true
+}
+
+// loadDict loads DICTPUSHCONST-like dictionary of methods and decompiles every method,
+// keys of PFXDICTSWITCH-like dictionaries are prefixes.
+func (d *Decoder) loadDict(r *reader, prefix bool) (uint64, DecompiledDict, error) {
+	keyLength := r.uint(10)
+	dictCell := r.ref()
+	if r.err != nil {
+		return 0, DecompiledDict{}, r.err
+	}
+	dict, err := d.decompileDict(dictCell, keyLength, prefix)
+	return keyLength, dict, err
+}
+
+// decompileDict decompiles values of the dictionary as code.
+func (d *Decoder) decompileDict(dictCell *cell.Cell, keyLength uint64, prefix bool) (DecompiledDict, error) {
+	if prefix {
+		leaves, err := loadPrefixDictLeaves(dictCell, uint(keyLength), d.cellsLeft())
+		if err != nil {
+			return DecompiledDict{}, err
+		}
+		methods := make([]DecompiledMethod, 0, len(leaves))
+		for _, leaf := range leaves {
+			code, err := d.decompileCell(leaf.value(), source{cell: leaf.cell, bits: leaf.offset})
+			if err != nil {
+				return DecompiledDict{}, err
+			}
+			methods = append(methods, DecompiledMethod{prefix: newBits(leaf.key), instructions: code.instructions})
+		}
+		return DecompiledDict{methods: methods, prefix: true}, nil
+	}
+
+	leaves, err := loadDictLeaves(dictCell, uint(keyLength), d.cellsLeft())
+	if err != nil {
+		return DecompiledDict{}, err
+	}
+	methods := make([]DecompiledMethod, 0, len(leaves))
+	for _, leaf := range leaves {
+		code, err := d.decompileCell(leaf.value(), source{cell: leaf.cell, bits: leaf.offset})
+		if err != nil {
+			return DecompiledDict{}, err
+		}
+		methods = append(methods, DecompiledMethod{id: signedKey(leaf.key, keyLength), instructions: code.instructions})
+	}
+	// Leaves are in the order of unsigned keys, so negative keys go last
+	slices.SortStableFunc(methods, func(a, b DecompiledMethod) int { return cmp.Compare(a.id, b.id) })
+	return DecompiledDict{methods: methods}, nil
+}
@@ -0,0 +1,289 @@
+package tasm
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"tasm-go/spec"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// loadJetton loads the code of the Jetton minter from testdata.
+func loadJetton(t *testing.T) *cell.Cell {
+	t.Helper()
+	data, err := os.ReadFile("../testdata/jetton_minter_discoverable_JettonMinter.boc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := cell.FromBOC(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// TestDecoderConcurrent checks that a decoder shared between goroutines decodes like a single one,
+// run it with -race to detect shared state.
+func TestDecoderConcurrent(t *testing.T) {
+	d, err := NewDecoder(spec.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := loadJetton(t)
+	expected, err := d.DecompileCell(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decompiled, err := d.DecompileCell(code)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = decompiled.String()
+		}()
+	}
+	wg.Wait()
+	for i, result := range results {
+		if result != expected.String() {
+			t.Errorf("goroutine %d: unexpected code:\n%s", i, result)
+		}
+	}
+}
+
+// TestDecodersOfDifferentSpecs checks that decoders of different specifications used side by side
+// decode by their own specifications.
+func TestDecodersOfDifferentSpecs(t *testing.T) {
+	tvmSpec := spec.Default()
+	renamed := tvmSpec
+	renamed.Instructions = slices.Clone(tvmSpec.Instructions)
+	for i := range renamed.Instructions {
+		if renamed.Instructions[i].Name == "INC" {
+			renamed.Instructions[i].Name = "INCREMENT"
+		}
+	}
+	original, err := NewDecoder(tvmSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewDecoder(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := cell.BeginCell().MustStoreUInt(0xa4, 8).EndCell() // INC
+	var wg sync.WaitGroup
+	for range 4 {
+		for d, expected := range map[*Decoder]string{original: "INC\n", other: "INCREMENT\n"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				decompiled, err := d.DecompileCell(code)
+				if err != nil || decompiled.String() != expected {
+					t.Errorf("expected %q, got %q %v", expected, decompiled, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// TestDecompileLenient checks UNKNOWN and TRUNCATED pseudo-instructions keeping the rest of the cell,
+// references decoded after them, and errors of the strict mode on the same code.
+func TestDecompileLenient(t *testing.T) {
+	tvmSpec := spec.Default()
+	lenient, err := NewDecoder(tvmSpec, WithLenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict, err := NewDecoder(tvmSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inc := cell.BeginCell().MustStoreUInt(0xa4, 8).EndCell()
+	tests := []struct {
+		name     string
+		code     *cell.Cell
+		expected string
+	}{
+		{
+			"invalid opcode",
+			cell.BeginCell().MustStoreUInt(0xa4f8ff, 24).MustStoreUInt(0xa5, 8).MustStoreRef(inc).EndCell(),
+			"INC\nUNKNOWN x{F8FFA5}\nref {\n    INC\n}\n",
+		},
+		{
+			"truncated argument",
+			cell.BeginCell().MustStoreUInt(0xa48112, 24).MustStoreRef(inc).EndCell(),
+			"INC\nTRUNCATED x{8112}\nref {\n    INC\n}\n",
+		},
+		{
+			"truncated opcode",
+			cell.BeginCell().MustStoreUInt(0xa4, 8).MustStoreUInt(0b101, 3).MustStoreRef(inc).EndCell(),
+			"INC\nTRUNCATED x{B_}\nref {\n    INC\n}\n",
+		},
+		{
+			"data in reference",
+			cell.BeginCell().MustStoreUInt(0x88, 8).MustStoreRef(cell.BeginCell().MustStoreUInt(0xf8ff, 16).EndCell()).EndCell(),
+			"PUSHREF {\n    UNKNOWN x{F8FF}\n}\n",
+		},
+	}
+	for _, test := range tests {
+		code, err := lenient.DecompileCell(test.code)
+		if err != nil || code.String() != test.expected {
+			t.Errorf("%s: expected:\n%s\ngot %v:\n%s", test.name, test.expected, err, code)
+		}
+		var decodeErr *DecodeError
+		if _, err := strict.DecompileCell(test.code); !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expected DecodeError in strict mode, got %v", test.name, err)
+		}
+	}
+}
+
+// sharedChain builds n cells `PUSHREF next` with the implicit jump to next, each one referenced
+// twice by the previous one, so the tree of the code has 2^n cells.
+func sharedChain(n int) *cell.Cell {
+	c := cell.BeginCell().MustStoreUInt(0xa4, 8).EndCell() // INC
+	for range n {
+		c = cell.BeginCell().MustStoreUInt(0x88, 8).MustStoreRef(c).MustStoreRef(c).EndCell()
+	}
+	return c
+}
+
+func TestDecompileSharedCells(t *testing.T) {
+	const depth = 64
+	code, err := DecompileCell(spec.Default(), sharedChain(depth))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := code.String()
+	labels := regexp.MustCompile(`(?m)^cell_[0-9a-f]{8}: \{$`).FindAllString(text, -1)
+	if len(labels) != depth {
+		t.Errorf("expected %d labelled blocks, got %d:\n%s", depth, len(labels), text)
+	}
+	if !strings.HasPrefix(text, "PUSHREF cell_") {
+		t.Errorf("expected reference by label, got:\n%s", text)
+	}
+
+	data, err := json.Marshal(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var instructions []struct {
+		Args []struct {
+			Label string          `json:"label"`
+			Code  json.RawMessage `json:"code"`
+		} `json:"args"`
+	}
+	if err := json.Unmarshal(data, &instructions); err != nil {
+		t.Fatal(err)
+	}
+	first, second := instructions[0].Args[0], instructions[1].Args[0]
+	if first.Label == "" || first.Label != second.Label || first.Code == nil || second.Code != nil {
+		t.Errorf("expected code of the shared cell once, got %s", data)
+	}
+	if strings.Count(string(data), `"label"`) != 2*depth {
+		t.Errorf("expected two references to each of %d cells, got %s", depth, data)
+	}
+
+	if report := RequiredVersion(code); report.Version != 0 {
+		t.Errorf("expected no required version, got %s", report)
+	}
+	if fift := code.Format(PrintFift()); strings.Count(fift, " constant cell_") != depth {
+		t.Errorf("expected %d constants, got:\n%s", depth, fift)
+	}
+	if err := RoundTrip(spec.Default(), sharedChain(depth)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecompileMaxCells(t *testing.T) {
+	// Prefix dictionary of PFXDICTSWITCH, whose forks reference the same node, has 2^20 leaves
+	node := cell.BeginCell().MustStoreUInt(0b00, 2).MustStoreUInt(0, 1).MustStoreUInt(0xa4, 8).EndCell()
+	for range 20 {
+		node = cell.BeginCell().MustStoreUInt(0b00, 2).MustStoreUInt(1, 1).MustStoreRef(node).MustStoreRef(node).EndCell()
+	}
+	code := cell.BeginCell().MustStoreUInt(0x3d2b, 14).MustStoreRef(node).MustStoreUInt(25, 10).EndCell()
+
+	for _, opts := range [][]Option{nil, {WithLenient()}, {WithMaxCells(1000)}} {
+		d, err := NewDecoder(spec.Default(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.DecompileCell(code); !errors.Is(err, ErrTooManyCells) {
+			t.Errorf("expected ErrTooManyCells, got %v", err)
+		}
+	}
+
+	d, err := NewDecoder(spec.Default(), WithMaxCells(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root and INC are decoded, the second reference to INC is shared
+	if _, err := d.DecompileCell(sharedChain(1)); err != nil {
+		t.Error(err)
+	}
+	if _, err := d.DecompileCell(sharedChain(3)); !errors.Is(err, ErrTooManyCells) {
+		t.Errorf("expected ErrTooManyCells, got %v", err)
+	}
+}
+
+// TestDecompilePrefixDict checks prefix dictionaries of PFXDICTSWITCH and of dispatch tables,
+// whose keys of variable length are printed as bitstrings.
+func TestDecompilePrefixDict(t *testing.T) {
+	// Keys b{01} => INC and b{1} => DEC of at most 4 bits: the root has the empty label and a fork,
+	// the left leaf has the label b{1} after the fork bit 0, the right one has the empty label
+	left := cell.BeginCell().MustStoreUInt(0b01010, 5).MustStoreUInt(0xa4, 8).EndCell()
+	right := cell.BeginCell().MustStoreUInt(0b000, 3).MustStoreUInt(0xa5, 8).EndCell()
+	dict := cell.BeginCell().MustStoreUInt(0b001, 3).MustStoreRef(left).MustStoreRef(right).EndCell()
+	const methods = "[\n    b{01} => {\n        INC\n    }\n    b{1} => {\n        DEC\n    }\n]"
+
+	pfxDictSwitch := func(keyLength uint64) *cell.Cell {
+		return cell.BeginCell().MustStoreUInt(0x3d2b, 14).MustStoreRef(dict).MustStoreUInt(keyLength, 10).EndCell()
+	}
+	code, err := DecompileCell(spec.Default(), pfxDictSwitch(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := code.String(); text != "PFXDICTSWITCH 4 "+methods+"\n" {
+		t.Errorf("unexpected code:\n%s", text)
+	}
+	args := code.Instructions()[0].Args()
+	decompiled, ok := args[len(args)-1].(DecompiledDict)
+	if !ok || !decompiled.Prefix() || len(decompiled.Methods()) != 2 {
+		t.Fatalf("expected prefix dictionary of 2 methods, got %v", args)
+	}
+	for i, prefix := range []string{"b{01}", "b{1}"} {
+		if method := decompiled.Methods()[i]; method.Prefix().Binary() != prefix || method.ID() != 0 {
+			t.Errorf("expected method %s, got %s with ID %d", prefix, method.Prefix().Binary(), method.ID())
+		}
+	}
+
+	// The label b{01} doesn't fit the key of 1 bit
+	if _, err := DecompileCell(spec.Default(), pfxDictSwitch(1)); err == nil || !strings.Contains(err.Error(), "label is longer than the key") {
+		t.Errorf("expected too long label, got %v", err)
+	}
+
+	// PUSHREF PUSHINT_8 4 PFXDICTGETJMP
+	table := cell.BeginCell().MustStoreUInt(0x88, 8).MustStoreRef(dict).MustStoreUInt(0x8004, 16).MustStoreUInt(0xf4aa, 16).EndCell()
+	code, err = DecompileCell(spec.Default(), table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := code.String(); text != "PUSHREF "+methods+" @keylen=4\nPUSHINT_8 4\nPFXDICTGETJMP\n" {
+		t.Errorf("unexpected dispatch table:\n%s", text)
+	}
+}
@@ -2,7 +2,6 @@ package tasm
 
 import (
 	"fmt"
-	"log"
 	"math/big"
 	"slices"
 	"strings"
@@ -11,84 +10,366 @@ import (
 	"github.com/xssnick/tonutils-go/tvm/cell"
 )
 
-// DecompileCell recursively decompiles TVM cell into sequence of instructions.
-func DecompileCell(tvmSpec spec.Specification, cell *cell.Cell) DecompiledCode {
-	if load == nil {
-		load = loader(tvmSpec.Instructions)
-	}
+type Control struct{ idx uint64 }
+type StackRegister struct{ idx int64 }
+type DecompiledCode struct {
+	instructions []DeserializedInstruction
+	// Hash of the referenced cell the code was decoded from, nil for the code in cell parts.
+	// The same cell may be referenced several times, see DecompiledCode.Format.
+	hash []byte
+}
 
-	return decompileCell(cell)
+// Bits is a raw bitstring that couldn't be decoded as instructions.
+type Bits struct {
+	data   []byte
+	length uint
 }
 
-// decompileCell recursively decompiles TVM cell into sequence of instructions.
-func decompileCell(cell *cell.Cell) DecompiledCode {
-	slice := cell.BeginParse()
-	result := make([]DeserializedInstruction, 0, 32)
+func (c Control) String() string       { return fmt.Sprintf("c%d", c.idx) }
+func (s StackRegister) String() string { return fmt.Sprintf("s%d", s.idx) }
+
+// Index returns the number of the control register, e.g. 4 for c4.
+func (c Control) Index() uint64 { return c.idx }
+
+// Index returns the depth of the stack register, e.g. 1 for s1. It's negative for s(-1) and s(-2).
+func (s StackRegister) Index() int64 { return s.idx }
 
-	// Parse all instructions in the current cell
-	for slice.BitsLeft() > 0 {
-		result = append(result, load(slice))
+// Data returns the bits aligned to the left, unused bits of the last byte are zero.
+func (b Bits) Data() []byte { return b.data }
+
+// newBits packs bits given one per byte.
+func newBits(bits []byte) Bits {
+	data := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		data[i/8] |= bit << (7 - i%8)
 	}
+	return Bits{data: data, length: uint(len(bits))}
+}
 
-	// And recursively process references to other cells
-	for slice.RefsNum() > 0 {
-		code := decompileCell(slice.MustLoadRef().MustToCell())
-		// ref is a special pseudo-instruction that denotes a code that placed in reference
-		result = append(result, DeserializedInstruction{name: "ref", args: []any{code}})
+// unpack returns bits one per byte, counterpart of newBits.
+func (b Bits) unpack() []byte {
+	bits := make([]byte, b.length)
+	for i := range bits {
+		bits[i] = (b.data[i/8] >> (7 - i%8)) & 1
 	}
+	return bits
+}
 
-	return DecompiledCode{result}
+// Binary formats bits in Fift binary notation, e.g. b{0110}.
+func (b Bits) Binary() string {
+	builder := strings.Builder{}
+	builder.WriteString("b{")
+	for i := uint(0); i < b.length; i++ {
+		builder.WriteByte('0' + (b.data[i/8]>>(7-i%8))&1)
+	}
+	builder.WriteString("}")
+	return builder.String()
 }
 
-type Control struct{ idx uint64 }
-type StackRegister struct{ idx int64 }
-type DecompiledCode struct{ instructions []DeserializedInstruction }
+// Len returns the number of bits.
+func (b Bits) Len() uint { return b.length }
+
+// String formats bits in Fift notation, e.g. x{A7_}, where _ denotes
+// that the last hex digit is completed with 1 bit and zeros.
+func (b Bits) String() string {
+	bits := make([]byte, 0, b.length+4)
+	for i := uint(0); i < b.length; i++ {
+		bits = append(bits, (b.data[i/8]>>(7-i%8))&1)
+	}
+	completed := len(bits)%4 != 0
+	if completed {
+		bits = append(bits, 1)
+		for len(bits)%4 != 0 {
+			bits = append(bits, 0)
+		}
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("x{")
+	for i := 0; i < len(bits); i += 4 {
+		builder.WriteString(fmt.Sprintf("%X", bits[i]<<3|bits[i+1]<<2|bits[i+2]<<1|bits[i+3]))
+	}
+	if completed {
+		builder.WriteString("_")
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
 
-func (c Control) String() string       { return fmt.Sprintf("c%d", c.idx) }
-func (s StackRegister) String() string { return fmt.Sprintf("s%d", s.idx) }
 func (d DecompiledCode) String() string {
+	return d.Format()
+}
+
+// Format prints the code with the given options, String() uses the default ones.
+// Cells referenced several times are printed once after the code as labelled blocks,
+// e.g. `cell_1a2b3c4d: { ... }`, and the references are printed as their labels.
+func (d DecompiledCode) Format(opts ...PrintOption) string {
+	p := newPrinter(opts)
+	shared := sharedCells(d)
+	for _, code := range shared {
+		p.labels[string(code.hash)] = true
+	}
+	if p.fift {
+		return p.fiftCode(d, shared)
+	}
 	builder := strings.Builder{}
 	for _, instruction := range d.instructions {
-		builder.WriteString(fmt.Sprintf("%s\n", instruction))
+		builder.WriteString(p.instruction(instruction, 0))
+		builder.WriteString("\n")
+	}
+	for _, code := range shared {
+		builder.WriteString("\n")
+		builder.WriteString(cellLabel(code.hash))
+		builder.WriteString(": ")
+		builder.WriteString(p.block(code, 0))
+		builder.WriteString("\n")
 	}
 	return builder.String()
 }
 
+// sharedCells returns the code of the cells referenced several times, every cell follows
+// the shared cells it references.
+func sharedCells(code DecompiledCode) []DecompiledCode {
+	counts := make(map[string]int)
+	var order []DecompiledCode
+	var walk func(instructions []DeserializedInstruction)
+	walk = func(instructions []DeserializedInstruction) {
+		for _, instruction := range instructions {
+			for _, arg := range instruction.args {
+				switch v := arg.(type) {
+				case DecompiledCode:
+					if v.hash == nil {
+						walk(v.instructions)
+						continue
+					}
+					// The code of a shared cell is the same for all references, so it's walked once
+					counts[string(v.hash)]++
+					if counts[string(v.hash)] == 1 {
+						walk(v.instructions)
+						order = append(order, v)
+					}
+				case DecompiledDict:
+					for _, method := range v.methods {
+						walk(method.instructions)
+					}
+				}
+			}
+		}
+	}
+	walk(code.instructions)
+	return slices.DeleteFunc(order, func(c DecompiledCode) bool { return counts[string(c.hash)] < 2 })
+}
+
+// cellLabel returns the label of the shared cell by the prefix of its hash.
+func cellLabel(hash []byte) string {
+	return fmt.Sprintf("cell_%x", hash[:4])
+}
+
+// Instructions returns the decoded instructions, code in references follows as `ref` pseudo-instructions.
+func (d DecompiledCode) Instructions() []DeserializedInstruction { return d.instructions }
+
+// CellHash returns the hash of the referenced cell the code was decoded from, nil for the code in cell parts.
+// The code of a cell referenced several times is shared, so walks of the code can visit it once.
+func (d DecompiledCode) CellHash() []byte { return d.hash }
+
 type DecompiledMethod struct {
-	id           uint64
+	id int64
+	// Key of prefix dictionaries, where id is zero
+	prefix       Bits
 	instructions []DeserializedInstruction
 }
 
+// ID returns the key of the method in the dictionary. Keys are signed, as DICTIGETJMP and
+// other idict operations read them, e.g. -1 is the ID of recv_external, see MethodNames.
+func (m DecompiledMethod) ID() int64 { return m.id }
+
+// Prefix returns the key of the method in a prefix dictionary, see DecompiledDict.Prefix.
+func (m DecompiledMethod) Prefix() Bits { return m.prefix }
+
+// Instructions returns the code of the method.
+func (m DecompiledMethod) Instructions() []DeserializedInstruction { return m.instructions }
+
 type DecompiledDict struct {
 	methods []DecompiledMethod
+	prefix  bool
 }
 
+// Methods returns the methods sorted by ID, or by Prefix in prefix dictionaries.
+func (d DecompiledDict) Methods() []DecompiledMethod { return d.methods }
+
+// Prefix reports whether the dictionary is a prefix code with keys of variable length, e.g. of PFXDICTSWITCH.
+// Such keys are bitstrings, which are printed as `b{0110} => { ... }`, and IDs of the methods are zero.
+func (d DecompiledDict) Prefix() bool { return d.prefix }
+
 type DeserializedInstruction struct {
 	name  string
-	instr *spec.Instruction // null, if it is pseudo `ref` instruction
-	args  []any             // see formatArg for actual types
+	instr *spec.Instruction // null, if it is pseudo `ref`, `UNKNOWN` or `TRUNCATED` instruction
+	args  []any             // see printer.arg for actual types
+	hints []string          // details of non-canonical encoding, printed as `@hint`
+	pos   Position
+}
+
+// Position is the location of an instruction in the code, as TVM reports it
+// in execution traces: inline continuations and dictionary values are located
+// in the cell which contains them.
+type Position struct {
+	// Representation hash of the cell
+	CellHash []byte
+	// Offset of the first bit of the instruction in the cell
+	Offset uint
+	// Number of bits of the instruction, including its arguments
+	Length uint
+	// Indices of the cell references consumed by the instruction
+	Refs []int
 }
 
+// Name returns the name of the instruction in the specification,
+// or `ref`, `UNKNOWN` and `TRUNCATED` for pseudo-instructions.
+func (d DeserializedInstruction) Name() string { return d.name }
+
+// Spec returns the instruction of the specification, nil for pseudo-instructions.
+func (d DeserializedInstruction) Spec() *spec.Instruction { return d.instr }
+
+// Args returns the decoded arguments in the layout order. Possible types are int64, uint64,
+// *big.Int, StackRegister, Control, Bits, *cell.Slice, DecompiledCode and DecompiledDict.
+// Dictionary instructions, e.g. DICTPUSHCONST, have the key length and the dictionary.
+func (d DeserializedInstruction) Args() []any { return d.args }
+
+// Hints returns details of non-canonical encoding, e.g. `len=2`, see RoundTrip.
+func (d DeserializedInstruction) Hints() []string { return d.hints }
+
+// Position returns the location of the instruction in the code.
+func (d DeserializedInstruction) Position() Position { return d.pos }
+
+// Offset returns the bit offset of the instruction in the cell, see Position.
+func (d DeserializedInstruction) Offset() uint { return d.pos.Offset }
+
+// Length returns the bit length of the instruction, including its arguments.
+func (d DeserializedInstruction) Length() uint { return d.pos.Length }
+
 func (d DeserializedInstruction) String() string {
 	return d.Print(0)
 }
 
 func (d DeserializedInstruction) Print(depth int) string {
+	return newPrinter(nil).instruction(d, depth)
+}
+
+// Format prints the instruction with the given options, see DecompiledCode.Format.
+func (d DeserializedInstruction) Format(opts ...PrintOption) string {
+	return newPrinter(opts).instruction(d, 0)
+}
+
+// PrintOption configures DecompiledCode.Format.
+type PrintOption func(*printer)
+
+type printer struct {
+	// Fift aliases by the actual instruction name, see PrintFiftAliases
+	aliases map[string][]*fiftAlias
+	// See PrintFift
+	fift bool
+	// See PrintCollapsed
+	collapsed bool
+	// See PrintMethodNames
+	methodNames *MethodNames
+	// Comments for instructions, see PrintComments
+	annotators []func(DeserializedInstruction) string
+	// Hashes of the shared cells printed as labels, see DecompiledCode.Format
+	labels map[string]bool
+}
+
+func newPrinter(opts []PrintOption) *printer {
+	p := &printer{labels: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *printer) instruction(d DeserializedInstruction, depth int) string {
+	if p.fift {
+		return p.fiftInstruction(d, depth)
+	}
 	indent := strings.Repeat("    ", depth)
 	builder := strings.Builder{}
 
+	name, args := normalizeName(d.name), d.args
+	if alias, aliasArgs, ok := p.alias(d); ok {
+		name, args = alias, aliasArgs
+	}
+
 	builder.WriteString(indent)
-	builder.WriteString(normalizeName(d.name))
+	builder.WriteString(name)
 	builder.WriteString(" ")
 
-	for i, arg := range d.args {
-		builder.WriteString(formatArg(arg, depth))
-		if i < len(d.args)-1 {
+	for i, arg := range args {
+		builder.WriteString(p.arg(arg, depth))
+		if i < len(args)-1 {
 			builder.WriteString(" ")
 		}
 	}
+	for _, hint := range d.hints {
+		builder.WriteString(" @")
+		builder.WriteString(hint)
+	}
+
+	return p.annotate(strings.TrimRight(builder.String(), " "), d)
+}
+
+// annotate appends comments to the line with the instruction name: the first line
+// in the default syntax, where the name precedes nested code, or the last one in Fift.
+func (p *printer) annotate(text string, d DeserializedInstruction, comments ...string) string {
+	for _, annotator := range p.annotators {
+		if comment := annotator(d); comment != "" {
+			comments = append(comments, comment)
+		}
+	}
+	if len(comments) == 0 {
+		return text
+	}
+	comment := " // " + strings.Join(comments, " ")
+	first, rest, multiline := strings.Cut(text, "\n")
+	if p.fift || !multiline {
+		return text + comment
+	}
+	return first + comment + "\n" + rest
+}
+
+// PrintComments annotates instructions with comments returned by the function,
+// empty comments are omitted. Comments of several options are joined.
+func PrintComments(comment func(DeserializedInstruction) string) PrintOption {
+	return func(p *printer) {
+		p.annotators = append(p.annotators, comment)
+	}
+}
 
-	return strings.TrimRight(builder.String(), " ")
+// PrintCollapsed prints nested code and dictionaries in the default syntax as `{ ... }` and `[ ... ]`,
+// e.g. for instructions of basic blocks, which don't include the nested code.
+func PrintCollapsed() PrintOption {
+	return func(p *printer) {
+		p.collapsed = true
+	}
+}
+
+// PrintPositions annotates every instruction with its Position: the prefix of
+// the cell hash, the bit offset and length, and the indices of consumed references,
+// e.g. `// cell 1A2B3C4D bit 24 len 16 refs 0`.
+func PrintPositions() PrintOption {
+	return PrintComments(func(d DeserializedInstruction) string {
+		pos := d.pos
+		if pos.CellHash == nil {
+			return ""
+		}
+		comment := fmt.Sprintf("cell %X bit %d len %d", pos.CellHash[:4], pos.Offset, pos.Length)
+		if len(pos.Refs) > 0 {
+			refs := make([]string, len(pos.Refs))
+			for i, ref := range pos.Refs {
+				refs[i] = fmt.Sprint(ref)
+			}
+			comment += " refs " + strings.Join(refs, ",")
+		}
+		return comment
+	})
 }
 
 // normalizeName converts TVM instruction names to readable format.
@@ -100,33 +381,42 @@ func normalizeName(name string) string {
 	return strings.ReplaceAll(name, "#", "_")
 }
 
-func formatArg(arg any, depth int) string {
+func (p *printer) arg(arg any, depth int) string {
 	indent := strings.Repeat("    ", depth)
 	switch v := arg.(type) {
 	case int64, uint64:
 		return fmt.Sprintf("%d", v)
-	case Control, StackRegister, *big.Int:
+	case Control, StackRegister, Bits, *big.Int:
 		return fmt.Sprintf("%s", v)
 	case *cell.Slice:
 		return v.String()
 	case DecompiledCode:
-		builder := strings.Builder{}
-		builder.WriteString("{\n")
-		for _, instruction := range v.instructions {
-			builder.WriteString(instruction.Print(depth + 1))
-			builder.WriteString("\n")
+		if p.labels[string(v.hash)] {
+			return cellLabel(v.hash)
 		}
-		builder.WriteString(indent)
-		builder.WriteString("}")
-		return builder.String()
+		if p.collapsed {
+			return "{ ... }"
+		}
+		return p.block(v, depth)
 	case DecompiledDict:
+		if p.collapsed {
+			return "[ ... ]"
+		}
 		builder := strings.Builder{}
 		builder.WriteString("[\n")
 		for _, method := range v.methods {
 			builder.WriteString(indent)
-			builder.WriteString(fmt.Sprintf("    %d => {\n", method.id))
+			if v.prefix {
+				builder.WriteString(fmt.Sprintf("    %s => {", method.prefix.Binary()))
+			} else {
+				builder.WriteString(fmt.Sprintf("    %d => {", method.id))
+			}
+			if name, ok := p.methodName(method.id); ok && !v.prefix {
+				builder.WriteString(" // " + name)
+			}
+			builder.WriteString("\n")
 			for _, instruction := range method.instructions {
-				builder.WriteString(instruction.Print(depth + 2))
+				builder.WriteString(p.instruction(instruction, depth+2))
 				builder.WriteString("\n")
 			}
 			builder.WriteString("    ")
@@ -137,217 +427,79 @@ func formatArg(arg any, depth int) string {
 		builder.WriteString("]")
 		return builder.String()
 	default:
-		log.Fatalf("unhandled value: %v", v)
-		return ""
+		// Printing must never fail, so unknown values are just marked in the output
+		return fmt.Sprintf("<unhandled %T>", v)
 	}
 }
 
-const maxOpcodeBits = 24
-
-type instructionWithRange struct {
-	min   int64
-	max   int64
-	instr *spec.Instruction
+// block prints the code as `{ ... }`.
+func (p *printer) block(code DecompiledCode, depth int) string {
+	builder := strings.Builder{}
+	builder.WriteString("{\n")
+	for _, instruction := range code.instructions {
+		builder.WriteString(p.instruction(instruction, depth+1))
+		builder.WriteString("\n")
+	}
+	builder.WriteString(strings.Repeat("    ", depth))
+	builder.WriteString("}")
+	return builder.String()
 }
 
-type loaderFunc func(slice *cell.Slice) DeserializedInstruction
-
-var load = loaderFunc(nil)
-
 // loadSlice loads a TVM slice according to specification.
 // In TVM, slices contain data followed by a completion tag (bit 1)
 // and optionally padding zeros. Function trims trailing zeros and completion tag.
-func loadSlice(slice *cell.Slice, arg spec.Arg) *cell.Slice {
-	// Determine the number of references in the slice
+// Non-canonical encoding is described by hints, see storeSlice.
+func loadSlice(r *reader, arg spec.Arg) (*cell.Slice, []string) {
+	// Determine the number of references in the slice, PUSHSLICE_REFS stores it with delta
+	refsArg := *arg.Refs
 	countRefs := uint64(0)
+	if refsArg.Empty == "delta" {
+		countRefs = uint64(*refsArg.Delta)
+		refsArg = *refsArg.Arg
+	}
 	// Refs length can be zero if slice doesn't have any references
-	if *arg.Refs.Len != 0 {
-		countRefs = slice.MustLoadUInt(uint(*arg.Refs.Len))
+	if *refsArg.Len != 0 {
+		countRefs += r.uint(uint(*refsArg.Len))
 	}
 
 	// Calculate slice length in bits: data + padding
-	y := slice.MustLoadUInt(uint(*arg.Bits.Len))
+	y := r.uint(uint(*arg.Bits.Len))
 	realLength := int64(y*8 + uint64(*arg.Pad))
-	r := slice.MustLoadSlice(uint(realLength))
+	data := r.bits(uint(realLength))
+	if r.err != nil {
+		return nil, nil
+	}
 
-	// Find completion tag (first 1 bit from the end) and trim everything after it
-	var length uint64
+	// Find completion tag (first 1 bit from the end) and trim everything after it (including the tag).
+	// Without completion tag TVM treats the slice as empty.
+	length := int64(-1)
 	for i := realLength - 1; i >= 0; i-- {
-		byteIdx := i / 8
-		dataByte := r[byteIdx]
-		bitShift := i % 8
 		// Check bit in big-endian order (MSB first)
-		bit := dataByte & (1 << (8 - bitShift))
-		if bit == 0 {
-			continue
+		if data[i/8]&(0x80>>(i%8)) != 0 {
+			length = i
+			break
 		}
-		// Found completion tag, trim everything after it (including the tag)
-		length = uint64(i - 1)
-		break
 	}
 
-	newSlice := cell.Builder{}
-	newSlice.MustStoreSlice(r, uint(length))
-	for i := uint64(0); i < countRefs; i++ {
-		newSlice.MustStoreRef(slice.MustLoadRef().MustToCell())
-	}
-	return newSlice.ToSlice()
-}
-
-// loader creates a function to parse TVM instructions based on specification.
-// TVM instructions have opcode ranges. Function builds a sorted list
-// of ranges for efficient instruction lookup by opcode.
-func loader(instructions []spec.Instruction) loaderFunc {
-	var instructionRanges []instructionWithRange
-	for _, instr := range instructions {
-		instructionRanges = append(instructionRanges, instructionWithRange{
-			min:   instr.Layout.Min,
-			max:   instr.Layout.Max,
-			instr: &instr,
-		})
-	}
-
-	var list []instructionWithRange
-	topOpcode := int64(1 << maxOpcodeBits)
-	slices.SortFunc(instructionRanges, func(a, b instructionWithRange) int {
-		return int(a.min - b.min)
-	})
-
-	upto := int64(0)
-	for _, instr := range instructionRanges {
-		if instr.min >= instr.max || instr.min < upto || instr.max > topOpcode {
-			panic("instruction list is invalid")
-		}
-		if upto < instr.min {
-			// Fill gaps with dummy instructions for continuous opcode range
-			list = append(list, instructionWithRange{min: upto, max: instr.min, instr: nil})
-		}
-		list = append(list, instr)
-		upto = instr.max
+	var hints []string
+	tagLength := int64(1)
+	if length < 0 {
+		hints = append(hints, "notag")
+		length, tagLength = 0, 0
 	}
-
-	if upto < topOpcode {
-		list = append(list, instructionWithRange{min: upto, max: topOpcode, instr: nil})
+	// Canonical encoding uses the minimal number of bytes to store data and tag
+	if canonical := max(0, (length+tagLength-*arg.Pad+7)/8); canonical != int64(y) {
+		hints = append(hints, fmt.Sprintf("len=%d", y))
 	}
 
-	return func(slice *cell.Slice) DeserializedInstruction {
-		// Preload 24 bits of opcode, since opcode can be up to 24 bits
-		bits := min(slice.BitsLeft(), maxOpcodeBits)
-		// If there are less than 24 bits left (last instruction), align the opcode to 24 bits
-		opcode := slice.MustPreloadUInt(bits) << (maxOpcodeBits - bits)
-
-		i := 0
-		j := len(list)
-
-		for j-i > 1 {
-			k := (j + i) >> 1
-			if k >= len(list) {
-				break
-			}
-			kElement := list[k]
-			if kElement.min <= int64(opcode) {
-				i = k
-			} else {
-				j = k
-			}
-		}
-
-		instr := list[i]
-		if instr.instr == nil {
-			panic("instruction is invalid")
-		}
-		layout := instr.instr.Layout
-
-		slice.MustLoadUInt(uint(layout.CheckLen)) // skip opcode, we already know an instruction
-
-		var args []any
-
-		// Process DICTPUSHCONST-like instructions with separate logic
-		if len(layout.Args) == 2 && layout.Args[0].Empty == "dict" {
-			keyLength := slice.MustLoadUInt(10)
-			dictCell, _ := slice.LoadRefCell()
-			dict := dictCell.AsDict(uint(keyLength))
-			keyValues, _ := dict.LoadAll()
-
-			methods := make([]DecompiledMethod, 0, len(keyValues))
-			for _, kv := range keyValues {
-				id := kv.Key.MustLoadUInt(uint(keyLength))
-				code := decompileCell(kv.Value.MustToCell())
-				methods = append(methods, DecompiledMethod{id, code.instructions})
-			}
-
-			args = append(args, keyLength, DecompiledDict{methods})
-		} else {
-			for _, child := range layout.Args {
-				switch child.Empty {
-				case "delta":
-					switch child.Arg.Empty {
-					case "uint":
-						args = append(args, slice.MustLoadUInt(uint(*child.Arg.Len))+uint64(*child.Delta))
-					case "int":
-						args = append(args, slice.MustLoadInt(uint(*child.Arg.Len))+int64(*child.Delta))
-					case "stack":
-						args = append(args, StackRegister{idx: slice.MustLoadInt(4) + int64(*child.Delta)})
-					}
-				case "int":
-					args = append(args, slice.MustLoadInt(uint(*child.Len)))
-				case "uint":
-					args = append(args, slice.MustLoadUInt(uint(*child.Len)))
-				case "tinyInt":
-					args = append(args, ((int64(slice.MustLoadUInt(4))+5)&15)-5)
-				case "largeInt":
-					y := slice.MustLoadUInt(5)
-					args = append(args, slice.MustLoadBigUInt(uint(3+((y&31)+2)*8)))
-				case "plduzArg":
-					args = append(args, ((slice.MustLoadUInt(3)&7)+1)<<5)
-				case "control":
-					args = append(args, Control{idx: slice.MustLoadUInt(4)})
-				case "stack":
-					args = append(args, StackRegister{idx: int64(slice.MustLoadUInt(4))})
-				case "s1":
-					args = append(args, StackRegister{idx: 1})
-				case "minusOne":
-					args = append(args, -1)
-				case "refCodeSlice":
-					val, _ := slice.LoadRefCell()
-					args = append(args, decompileCell(val))
-				case "inlineCodeSlice":
-					y := slice.MustLoadUInt(uint(*child.Bits.Len))
-					realLength := y * 8
-					r := slice.MustLoadSlice(uint(realLength))
-					sliceBuilder := cell.Builder{}
-					sliceBuilder.MustStoreSlice(r, uint(realLength))
-					args = append(args, decompileCell(sliceBuilder.EndCell()))
-				case "codeSlice":
-					countRefs := slice.MustLoadUInt(uint(*child.Refs.Len))
-					y := slice.MustLoadUInt(uint(*child.Bits.Len))
-					realLength := y * 8
-					r := slice.MustLoadSlice(uint(realLength))
-					sliceBuilder := cell.Builder{}
-					sliceBuilder.MustStoreSlice(r, uint(realLength))
-					for i := uint64(0); i < countRefs; i++ {
-						sliceBuilder.MustStoreRef(slice.MustLoadRef().MustToCell())
-					}
-					args = append(args, decompileCell(sliceBuilder.EndCell()))
-				case "slice":
-					args = append(args, loadSlice(slice, child))
-				case "debugstr":
-					y := slice.MustLoadUInt(4)
-					realLength := (y + 1) * 8
-					r := slice.MustLoadSlice(uint(realLength))
-					sliceBuilder := cell.Builder{}
-					sliceBuilder.MustStoreSlice(r, uint(realLength))
-					args = append(args, sliceBuilder.ToSlice())
-				default:
-					log.Fatalf("unhandled type of arg: %v", child)
-				}
-			}
-		}
-
-		return DeserializedInstruction{
-			name:  instr.instr.Name,
-			instr: instr.instr,
-			args:  args,
+	newSlice := cell.Builder{}
+	newSlice.MustStoreSlice(data, uint(length))
+	for i := uint64(0); i < countRefs; i++ {
+		ref := r.ref()
+		if r.err != nil {
+			return nil, nil
 		}
+		newSlice.MustStoreRef(ref)
 	}
+	return newSlice.ToSlice(), hints
 }
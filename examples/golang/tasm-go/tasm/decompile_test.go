@@ -0,0 +1,64 @@
+package tasm
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"tasm-go/spec"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// TestPositions checks positions of instructions inline in the cell, in an inline continuation,
+// consuming references and in a cell referenced twice.
+func TestPositions(t *testing.T) {
+	child := cell.BeginCell().MustStoreUInt(0xa5, 8).EndCell() // DEC
+	// INC PUSHCONT_SHORT { NOP } PUSHREF child, then the implicit jump to child
+	root := cell.BeginCell().MustStoreUInt(0xa4, 8).MustStoreUInt(0x91, 8).MustStoreUInt(0x00, 8).MustStoreUInt(0x88, 8).
+		MustStoreRef(child).MustStoreRef(child).EndCell()
+	code, err := DecompileCell(spec.Default(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instructions := code.Instructions()
+	pushCont, pushRef, ref := instructions[1], instructions[2], instructions[3]
+	nop := pushCont.Args()[0].(DecompiledCode).Instructions()[0]
+	tests := []struct {
+		instruction DeserializedInstruction
+		expected    Position
+	}{
+		{instructions[0], Position{root.Hash(), 0, 8, nil}},
+		{pushCont, Position{root.Hash(), 8, 16, nil}},
+		// Inline continuations are executed in place
+		{nop, Position{root.Hash(), 16, 8, nil}},
+		{pushRef, Position{root.Hash(), 24, 8, []int{0}}},
+		{ref, Position{root.Hash(), 32, 0, []int{1}}},
+		// Both references of the cell have the same position
+		{pushRef.Args()[0].(DecompiledCode).Instructions()[0], Position{child.Hash(), 0, 8, nil}},
+		{ref.Args()[0].(DecompiledCode).Instructions()[0], Position{child.Hash(), 0, 8, nil}},
+	}
+	for _, test := range tests {
+		pos := test.instruction.Position()
+		if !bytes.Equal(pos.CellHash, test.expected.CellHash) || pos.Offset != test.expected.Offset ||
+			pos.Length != test.expected.Length || !slices.Equal(pos.Refs, test.expected.Refs) {
+			t.Errorf("%s: expected %+v, got %+v", test.instruction.Name(), test.expected, pos)
+		}
+	}
+
+	expected := fmt.Sprintf(`INC // cell %[1]X bit 0 len 8
+PUSHCONT_SHORT { // cell %[1]X bit 8 len 16
+    NOP // cell %[1]X bit 16 len 8
+}
+PUSHREF cell_%[2]x // cell %[1]X bit 24 len 8 refs 0
+ref cell_%[2]x // cell %[1]X bit 32 len 0 refs 1
+
+cell_%[2]x: {
+    DEC // cell %[2]X bit 0 len 8
+}
+`, root.Hash()[:4], child.Hash()[:4])
+	if text := code.Format(PrintPositions()); text != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, text)
+	}
+}
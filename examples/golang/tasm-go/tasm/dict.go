@@ -0,0 +1,189 @@
+package tasm
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// dictLeaf is a value of a hashmap together with its location in the leaf cell.
+type dictLeaf struct {
+	key  uint64
+	cell *cell.Cell
+	// Offset of the value in the leaf cell, after the label
+	offset uint
+}
+
+// value returns the value as a separate cell.
+func (l dictLeaf) value() *cell.Cell {
+	slice := l.cell.BeginParse()
+	slice.MustLoadSlice(l.offset)
+	return slice.MustToCell()
+}
+
+// loadDictLeaves walks a hashmap with keys of fixed length in the order of unsigned keys.
+// Unlike cell.Dictionary it keeps the leaf cells, so that positions of values are known.
+// Forks may share cells, so the number of leaves is limited by maxLeaves, see WithMaxCells.
+func loadDictLeaves(root *cell.Cell, keyLength uint, maxLeaves int) ([]dictLeaf, error) {
+	if keyLength > 64 {
+		return nil, errors.New("dictionary keys longer than 64 bits are not supported")
+	}
+	var leaves []dictLeaf
+	err := walkDict(root, 0, keyLength, maxLeaves, &leaves)
+	return leaves, err
+}
+
+// errTooManyLeaves is returned when the dictionary has more than maxLeaves values.
+func errTooManyLeaves(maxLeaves int) error {
+	return fmt.Errorf("%w: dictionary has more than %d values", ErrTooManyCells, maxLeaves)
+}
+
+// prefixLeaf is a value of a prefix dictionary, keys have variable length.
+type prefixLeaf struct {
+	// Bits of the key, one bit per byte
+	key    []byte
+	cell   *cell.Cell
+	offset uint
+}
+
+// loadPrefixDictLeaves walks a prefix dictionary with keys of at most keyLength bits, e.g. of PFXDICTSWITCH:
+//
+//	phm_edge#_ label:(HmLabel ~l n) {n = (~m) + l} node:(PfxHashmapNode m X) = PfxHashmap n X;
+//	phmn_leaf$0 value:X = PfxHashmapNode n X;
+//	phmn_fork$1 left:^(PfxHashmap n X) right:^(PfxHashmap n X) = PfxHashmapNode (n + 1) X;
+func loadPrefixDictLeaves(root *cell.Cell, keyLength uint, maxLeaves int) ([]prefixLeaf, error) {
+	var leaves []prefixLeaf
+	err := walkPrefixDict(root, nil, keyLength, maxLeaves, &leaves)
+	return leaves, err
+}
+
+// value returns the value as a separate cell.
+func (l prefixLeaf) value() *cell.Cell {
+	return dictLeaf{cell: l.cell, offset: l.offset}.value()
+}
+
+func walkPrefixDict(c *cell.Cell, key []byte, remaining uint, maxLeaves int, leaves *[]prefixLeaf) error {
+	slice := c.BeginParse()
+	label, err := loadLabelBits(slice, remaining)
+	if err != nil {
+		return err
+	}
+	key = append(slices.Clip(key), label...)
+	remaining -= uint(len(label))
+
+	isFork, err := slice.LoadUInt(1)
+	if err != nil {
+		return err
+	}
+	if isFork == 0 {
+		if len(*leaves) >= maxLeaves {
+			return errTooManyLeaves(maxLeaves)
+		}
+		*leaves = append(*leaves, prefixLeaf{key: key, cell: c, offset: c.BitsSize() - slice.BitsLeft()})
+		return nil
+	}
+	if remaining == 0 {
+		return errors.New("prefix dictionary fork is longer than the key")
+	}
+	for bit := range byte(2) {
+		child, err := slice.LoadRefCell()
+		if err != nil {
+			return err
+		}
+		if err := walkPrefixDict(child, append(slices.Clip(key), bit), remaining-1, maxLeaves, leaves); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkDict(c *cell.Cell, key uint64, remaining uint, maxLeaves int, leaves *[]dictLeaf) error {
+	slice := c.BeginParse()
+	n, label, err := loadLabel(slice, remaining)
+	if err != nil {
+		return err
+	}
+	key = key<<n | label
+	remaining -= n
+
+	if remaining == 0 {
+		if len(*leaves) >= maxLeaves {
+			return errTooManyLeaves(maxLeaves)
+		}
+		*leaves = append(*leaves, dictLeaf{key: key, cell: c, offset: c.BitsSize() - slice.BitsLeft()})
+		return nil
+	}
+	// Fork has two children, the next bit of the key is 0 for the left one and 1 for the right one
+	for bit := range uint64(2) {
+		child, err := slice.LoadRefCell()
+		if err != nil {
+			return err
+		}
+		if err := walkDict(child, key<<1|bit, remaining-1, maxLeaves, leaves); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadLabel loads hashmap label of at most maxLen bits, counterpart of storeLabel.
+func loadLabel(slice *cell.Slice, maxLen uint) (uint, uint64, error) {
+	labelBits, err := loadLabelBits(slice, maxLen)
+	if err != nil {
+		return 0, 0, err
+	}
+	var label uint64
+	for _, bit := range labelBits {
+		label = label<<1 | uint64(bit)
+	}
+	return uint(len(labelBits)), label, nil
+}
+
+// loadLabelBits loads hashmap label of at most maxLen bits, one bit per byte,
+// since labels of prefix dictionaries may be longer than 64 bits.
+func loadLabelBits(slice *cell.Slice, maxLen uint) ([]byte, error) {
+	r := &reader{slice: slice}
+	k := uint(bits.Len(maxLen))
+	var n uint
+	same := -1
+	switch {
+	case r.uint(1) == 0:
+		// hml_short$0 len:(Unary ~n) s:(n * Bit)
+		for r.uint(1) == 1 && r.err == nil {
+			n++
+		}
+	case r.uint(1) == 0:
+		// hml_long$10 n:(#<= m) s:(n * Bit)
+		n = uint(r.uint(k))
+	default:
+		// hml_same$11 v:Bit n:(#<= m)
+		same = int(r.uint(1))
+		n = uint(r.uint(k))
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if n > maxLen {
+		return nil, errors.New("dictionary label is longer than the key")
+	}
+	label := make([]byte, n)
+	for i := range label {
+		if same >= 0 {
+			label[i] = byte(same)
+		} else {
+			label[i] = byte(r.uint(1))
+		}
+	}
+	return label, r.err
+}
+
+// signedKey interprets the dictionary key as a signed integer, as idict operations do.
+func signedKey(key uint64, keyLength uint64) int64 {
+	if keyLength > 0 && keyLength < 64 && key>>(keyLength-1) == 1 {
+		return int64(key) - int64(1)<<keyLength
+	}
+	return int64(key)
+}
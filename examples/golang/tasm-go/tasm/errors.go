@@ -0,0 +1,67 @@
+package tasm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tasm-go/spec"
+)
+
+var (
+	// ErrInvalidOpcode is returned when the opcode falls into a range that is
+	// not covered by any instruction of the specification.
+	ErrInvalidOpcode = errors.New("invalid opcode")
+	// ErrUnsupportedArg is returned when the specification describes an argument
+	// kind that the decoder doesn't know how to read.
+	ErrUnsupportedArg = errors.New("unsupported argument type")
+	// ErrUnsupportedVersion is returned when the instruction was introduced in a TVM version
+	// later than the one targeted by WithTVMVersion.
+	ErrUnsupportedVersion = errors.New("instruction is not supported by the TVM version")
+	// ErrTooManyCells is returned when the code has more cells than allowed by WithMaxCells,
+	// e.g. a dictionary which shares subtrees between many keys.
+	ErrTooManyCells = errors.New("too many cells")
+)
+
+// DecodeError describes the place in the code where decoding has failed.
+type DecodeError struct {
+	// Representation hash of the cell that was being decoded
+	CellHash []byte
+	// Bit offset of the failed instruction inside the cell
+	Offset uint
+	// Raw opcode bits, left-aligned to 24 bits as the loader sees them
+	Opcode uint64
+	// Number of meaningful bits in Opcode (less than 24 at the end of the cell)
+	OpcodeLen uint
+	// Name of the recognized instruction, empty if the opcode is invalid
+	Instruction string
+	// Kind of the argument which couldn't be read, empty if the failure is not related to arguments
+	Arg spec.Empty
+	// Underlying error
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("cell %X, bit %d, opcode %s", e.CellHash, e.Offset, formatOpcode(e.Opcode, e.OpcodeLen)))
+	if e.Instruction != "" {
+		builder.WriteString(fmt.Sprintf(", instruction %s", e.Instruction))
+	}
+	if e.Arg != "" {
+		builder.WriteString(fmt.Sprintf(", arg %s", e.Arg))
+	}
+	builder.WriteString(": ")
+	builder.WriteString(e.Err.Error())
+	return builder.String()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// formatOpcode prints opcode bits in binary, since opcodes are not byte-aligned.
+func formatOpcode(opcode uint64, bits uint) string {
+	if bits == 0 {
+		return "b{}"
+	}
+	return fmt.Sprintf("b{%0*b}", bits, opcode>>(maxOpcodeBits-bits))
+}
@@ -0,0 +1,95 @@
+package tasm
+
+import (
+	"bytes"
+	"errors"
+	"tasm-go/spec"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// TestDecodeError checks that malformed code is reported with the place of the failure instead of a panic.
+func TestDecodeError(t *testing.T) {
+	tvmSpec := spec.Default()
+	invalid := cell.BeginCell().MustStoreUInt(0xf8ff, 16).EndCell()
+	tests := []struct {
+		name string
+		code *cell.Cell
+		// Cell containing the failed instruction
+		cell        *cell.Cell
+		offset      uint
+		opcode      string
+		instruction string
+		arg         spec.Empty
+		invalid     bool
+	}{
+		{
+			name:        "truncated PUSHINT_16",
+			code:        cell.BeginCell().MustStoreUInt(0xa4, 8).MustStoreUInt(0x8112, 16).EndCell(),
+			offset:      8,
+			opcode:      "b{1000000100010010}",
+			instruction: "PUSHINT_16",
+			arg:         "int",
+		},
+		{
+			name:    "invalid opcode",
+			code:    cell.BeginCell().MustStoreUInt(0xa4, 8).MustStoreUInt(0xf8ff, 16).EndCell(),
+			offset:  8,
+			opcode:  "b{1111100011111111}",
+			invalid: true,
+		},
+		{
+			name:        "missing reference",
+			code:        cell.BeginCell().MustStoreUInt(0x8a, 8).EndCell(),
+			opcode:      "b{10001010}",
+			instruction: "PUSHREFCONT",
+			arg:         "refCodeSlice",
+		},
+		{
+			name:        "truncated slice",
+			code:        cell.BeginCell().MustStoreUInt(0x8b1, 12).EndCell(),
+			opcode:      "b{100010110001}",
+			instruction: "PUSHSLICE",
+			arg:         "slice",
+		},
+		{
+			name:    "invalid opcode in reference",
+			code:    cell.BeginCell().MustStoreUInt(0xa4, 8).MustStoreRef(invalid).EndCell(),
+			cell:    invalid,
+			opcode:  "b{1111100011111111}",
+			invalid: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecompileCell(tvmSpec, test.code)
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("expected DecodeError, got %v", err)
+			}
+			expectedCell := test.code
+			if test.cell != nil {
+				expectedCell = test.cell
+			}
+			if !bytes.Equal(decodeErr.CellHash, expectedCell.Hash()) || decodeErr.Offset != test.offset {
+				t.Errorf("expected cell %X at bit %d, got %X at bit %d", expectedCell.Hash(), test.offset, decodeErr.CellHash, decodeErr.Offset)
+			}
+			if opcode := formatOpcode(decodeErr.Opcode, decodeErr.OpcodeLen); opcode != test.opcode {
+				t.Errorf("expected opcode %s, got %s", test.opcode, opcode)
+			}
+			if decodeErr.Instruction != test.instruction || decodeErr.Arg != test.arg {
+				t.Errorf("expected instruction %q and arg %q, got %q and %q", test.instruction, test.arg, decodeErr.Instruction, decodeErr.Arg)
+			}
+			if errors.Is(err, ErrInvalidOpcode) != test.invalid {
+				t.Errorf("expected invalid opcode %v, got %v", test.invalid, err)
+			}
+		})
+	}
+
+	// The empty cell is the empty code
+	code, err := DecompileCell(tvmSpec, cell.BeginCell().EndCell())
+	if err != nil || code.String() != "" {
+		t.Errorf("expected empty code, got %q %v", code, err)
+	}
+}
@@ -0,0 +1,564 @@
+package tasm
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"tasm-go/spec"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// fiftAlias is a Fift name of a TVM instruction, possibly with some of the arguments fixed,
+// e.g. FALSE is PUSHINT_4 0 and -ROLL n is BLKSWAP n 1.
+type fiftAlias struct {
+	name       string
+	actualName string
+	// Arguments of the actual instruction, nil if the alias has the same arguments
+	args []aliasArg
+	// Number of arguments of the alias itself, valid only if args is not nil
+	argCount int
+}
+
+// aliasArg is an argument of the actual instruction: a constant or
+// an expression of the alias argument `sign * $args[param] + add`.
+type aliasArg struct {
+	constant *big.Int
+	bits     *Bits
+	param    int
+	negate   bool
+	add      int64
+}
+
+var aliasArgRe = regexp.MustCompile(`^(-\s*)?\$args\[(\d+)\](?:\s*([+-])\s*(\d+))?$`)
+
+// parseFiftAlias parses arguments of the Fift instruction, which are integers,
+// bitstrings like b{0} and simple expressions like `$args[0] + 1` or `- $args[0]`.
+func parseFiftAlias(fift spec.FiftInstruction) (*fiftAlias, error) {
+	alias := &fiftAlias{name: fift.Name, actualName: fift.ActualName}
+	if len(fift.Arguments) == 0 {
+		return alias, nil
+	}
+
+	alias.args = make([]aliasArg, len(fift.Arguments))
+	for i, arg := range fift.Arguments {
+		switch {
+		case arg.Integer != nil:
+			alias.args[i].constant = big.NewInt(*arg.Integer)
+		case arg.String == nil:
+			return nil, fmt.Errorf("%w: fift instruction %s: empty argument", ErrInvalidSpecification, fift.Name)
+		case len(*arg.String) > 2 && (*arg.String)[1] == '{':
+			bits, err := parseBits(*arg.String)
+			if err != nil {
+				return nil, fmt.Errorf("%w: fift instruction %s: %w", ErrInvalidSpecification, fift.Name, err)
+			}
+			alias.args[i].bits = &bits
+		default:
+			m := aliasArgRe.FindStringSubmatch(*arg.String)
+			if m == nil {
+				return nil, fmt.Errorf("%w: fift instruction %s: unsupported argument %q", ErrInvalidSpecification, fift.Name, *arg.String)
+			}
+			param, _ := strconv.Atoi(m[2])
+			add, _ := strconv.ParseInt(m[4], 10, 64)
+			if m[3] == "-" {
+				add = -add
+			}
+			alias.args[i] = aliasArg{param: param, negate: m[1] != "", add: add}
+		}
+	}
+
+	// Parameter indices are compacted, e.g. SETNUMARGS refers to $args[1] as its only argument
+	var params []int
+	for _, arg := range alias.args {
+		if arg.constant == nil && arg.bits == nil && !slices.Contains(params, arg.param) {
+			params = append(params, arg.param)
+		}
+	}
+	slices.Sort(params)
+	for i := range alias.args {
+		alias.args[i].param = slices.Index(params, alias.args[i].param)
+	}
+	alias.argCount = len(params)
+	return alias, nil
+}
+
+// fixed reports whether the alias denotes a particular case of the instruction
+// rather than just another name for it.
+func (a *fiftAlias) fixed() bool {
+	for _, arg := range a.args {
+		if arg.constant != nil || arg.bits != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns arguments of the alias if decoded arguments of the actual instruction fit its pattern.
+func (a *fiftAlias) match(args []any) ([]any, bool) {
+	if len(a.args) != len(args) {
+		return nil, false
+	}
+
+	result := make([]any, a.argCount)
+	for i, pattern := range a.args {
+		switch {
+		case pattern.bits != nil:
+			slice, ok := args[i].(*cell.Slice)
+			if !ok || slice.RefsNum() != 0 || slice.BitsLeft() != pattern.bits.length {
+				return nil, false
+			}
+			data, _ := slice.Copy().LoadSlice(slice.BitsLeft())
+			if (Bits{data: data, length: pattern.bits.length}).String() != pattern.bits.String() {
+				return nil, false
+			}
+		case pattern.constant != nil:
+			v, ok := argInt(args[i])
+			if !ok || v.Cmp(pattern.constant) != 0 {
+				return nil, false
+			}
+		default:
+			value := args[i]
+			if pattern.negate || pattern.add != 0 {
+				// Solve `sign * x + add = value` for x
+				v, ok := argInt(value)
+				if !ok {
+					return nil, false
+				}
+				x := new(big.Int).Sub(v, big.NewInt(pattern.add))
+				if pattern.negate {
+					x.Neg(x)
+				}
+				value = x
+			}
+			if prev := result[pattern.param]; prev != nil && fmt.Sprint(prev) != fmt.Sprint(value) {
+				return nil, false
+			}
+			result[pattern.param] = value
+		}
+	}
+	for _, arg := range result {
+		if arg == nil {
+			return nil, false
+		}
+	}
+	return result, true
+}
+
+// expand converts parsed arguments of the alias into arguments of the actual instruction.
+func (a *fiftAlias) expand(instr *spec.Instruction, args []any) ([]any, error) {
+	if a.args == nil {
+		return args, nil
+	}
+	if len(a.args) != len(instr.Layout.Args) {
+		return nil, fmt.Errorf("%w: fift instruction %s has %d arguments, %s has %d",
+			ErrInvalidSpecification, a.name, len(a.args), instr.Name, len(instr.Layout.Args))
+	}
+
+	result := make([]any, len(a.args))
+	for i, pattern := range a.args {
+		switch {
+		case pattern.bits != nil:
+			result[i] = bitsToCell(*pattern.bits)
+		case pattern.constant != nil:
+			// Constants are written as numbers, but registers are expected for some args
+			kind := instr.Layout.Args[i]
+			if kind.Empty == "delta" {
+				kind = *kind.Arg
+			}
+			switch kind.Empty {
+			case "control":
+				result[i] = Control{idx: pattern.constant.Uint64()}
+			case "stack":
+				result[i] = StackRegister{idx: pattern.constant.Int64()}
+			default:
+				result[i] = new(big.Int).Set(pattern.constant)
+			}
+		default:
+			value := args[pattern.param]
+			if pattern.negate || pattern.add != 0 {
+				v, ok := value.(*big.Int)
+				if !ok {
+					return nil, ErrArgMismatch
+				}
+				x := new(big.Int).Set(v)
+				if pattern.negate {
+					x.Neg(x)
+				}
+				value = x.Add(x, big.NewInt(pattern.add))
+			}
+			result[i] = value
+		}
+	}
+	return result, nil
+}
+
+// argInt returns decoded integer argument, including register indices.
+func argInt(arg any) (*big.Int, bool) {
+	switch v := arg.(type) {
+	case int64:
+		return big.NewInt(v), true
+	case uint64:
+		return new(big.Int).SetUint64(v), true
+	case *big.Int:
+		return v, true
+	case Control:
+		return new(big.Int).SetUint64(v.idx), true
+	case StackRegister:
+		return big.NewInt(v.idx), true
+	}
+	return nil, false
+}
+
+func bitsToCell(b Bits) *cell.Cell {
+	return cell.BeginCell().MustStoreSlice(b.data, b.length).EndCell()
+}
+
+// PrintFiftAliases prints instructions by the Fift alias whose fixed arguments match
+// the decoded ones, e.g. PUSHINT_4 0 as FALSE, PUSHCTR c4 as PUSHROOT and BLKSWAP 2 1
+// as -ROLL 2. Aliases that just rename an instruction, e.g. CALLX for EXECUTE, are not used.
+// If several aliases match, the first one in the specification is chosen.
+// Aliases which can't be parsed are ignored, NewAssembler reports them.
+func PrintFiftAliases(tvmSpec spec.Specification) PrintOption {
+	aliases := make(map[string][]*fiftAlias)
+	for _, fift := range tvmSpec.FiftInstructions {
+		alias, err := parseFiftAlias(fift)
+		if err != nil || !alias.fixed() {
+			continue
+		}
+		aliases[alias.actualName] = append(aliases[alias.actualName], alias)
+	}
+	return func(p *printer) {
+		p.aliases = aliases
+	}
+}
+
+// alias returns the Fift alias name and its arguments for the instruction, see PrintFiftAliases.
+func (p *printer) alias(d DeserializedInstruction) (string, []any, bool) {
+	if d.instr == nil {
+		return "", nil, false
+	}
+	for _, alias := range p.aliases[d.instr.Name] {
+		if args, ok := alias.match(d.args); ok {
+			return alias.name, args, true
+		}
+	}
+	return "", nil, false
+}
+
+// fiftNames maps instructions of the specification to Fift mnemonics, where they differ.
+// Fift chooses the encoding itself, so all the encodings of an instruction have the same mnemonic.
+var fiftNames = map[string]string{
+	"PUSHINT_4":        "PUSHINT",
+	"PUSHINT_8":        "PUSHINT",
+	"PUSHINT_16":       "PUSHINT",
+	"PUSHINT_LONG":     "PUSHINT",
+	"PUSHCONT_SHORT":   "PUSHCONT",
+	"PUSHSLICE_REFS":   "PUSHSLICE",
+	"PUSHSLICE_LONG":   "PUSHSLICE",
+	"XCHG_0I":          "XCHG0",
+	"XCHG_0I_LONG":     "XCHG0",
+	"XCHG_IJ":          "XCHG",
+	"XCHG_1I":          "XCHG",
+	"XCHG3_ALT":        "XCHG3",
+	"PUSH_LONG":        "PUSH",
+	"POP_LONG":         "POP",
+	"STREF_ALT":        "STREF",
+	"STSLICE_ALT":      "STSLICE",
+	"STI_ALT":          "STI",
+	"STU_ALT":          "STU",
+	"LDI_ALT":          "LDI",
+	"LDU_ALT":          "LDU",
+	"LDSLICE_ALT":      "LDSLICE",
+	"LSHIFT":           "LSHIFT#",
+	"RSHIFT":           "RSHIFT#",
+	"QLSHIFT":          "QLSHIFT#",
+	"QRSHIFT":          "QRSHIFT#",
+	"LSHIFT_VAR":       "LSHIFT",
+	"RSHIFT_VAR":       "RSHIFT",
+	"RSHIFT_ALT":       "RSHIFT",
+	"QLSHIFT_VAR":      "QLSHIFT",
+	"QRSHIFT_VAR":      "QRSHIFT",
+	"QRSHIFT_ALT":      "QRSHIFT",
+	"BCHKBITS_VAR":     "BCHKBITS",
+	"BCHKBITSQ_VAR":    "BCHKBITSQ",
+	"CALLDICT_LONG":    "CALLDICT",
+	"THROW_SHORT":      "THROW",
+	"THROWIF_SHORT":    "THROWIF",
+	"THROWIFNOT_SHORT": "THROWIFNOT",
+	"DEBUG_1":          "DEBUG",
+	"DEBUG_2":          "DEBUG",
+	"CALLXARGS_1":      "CALLXARGS",
+	"SETCP_SHORT":      "SETCP",
+}
+
+// fiftPlainStackArgs lists instructions whose stack arguments are written as numbers in Fift.
+var fiftPlainStackArgs = map[string]bool{
+	"BLKPUSH": true,
+}
+
+// PrintFift prints the code as a Fift script, which Asm.fif assembles into the code cell:
+// instructions follow their arguments, code blocks are written as <{ ... }>, slices as
+// x{...} or b{...} literals. The method dictionary of a contract, i.e. the code which
+// starts with SETCP0 and 19 DICTPUSHCONST, is written as PROGRAM{ ... }END>c.
+// Fift chooses the encoding of instructions itself, so the assembled cell may
+// differ from the original one, non-canonical encodings are marked with comments.
+func PrintFift() PrintOption {
+	return func(p *printer) {
+		p.fift = true
+	}
+}
+
+// fiftCode prints the whole code as a Fift script. Shared cells are defined as constants
+// before the code, e.g. `<{ ... }>c constant cell_1a2b3c4d`.
+func (p *printer) fiftCode(d DecompiledCode, shared []DecompiledCode) string {
+	builder := strings.Builder{}
+	builder.WriteString("\"Asm.fif\" include\n")
+	for _, code := range shared {
+		builder.WriteString(p.fiftBlock(code, 0))
+		builder.WriteString("c constant ")
+		builder.WriteString(cellLabel(code.hash))
+		builder.WriteString("\n")
+	}
+	if dict, ok := fiftProgram(d); ok {
+		builder.WriteString(p.fiftProgram(dict))
+		builder.WriteString("\n")
+		return builder.String()
+	}
+	builder.WriteString("<{\n")
+	for _, instruction := range d.instructions {
+		builder.WriteString(p.fiftInstruction(instruction, 1))
+		builder.WriteString("\n")
+	}
+	builder.WriteString("}>c\n")
+	return builder.String()
+}
+
+// fiftProgram checks whether the code is the method dictionary created by PROGRAM{ ... }END>c:
+//
+//	SETCP0 19 DICTPUSHCONST DICTIGETJMPZ 11 THROWARG
+func fiftProgram(d DecompiledCode) (DecompiledDict, bool) {
+	is := func(i int, name string, args ...int64) bool {
+		instr := d.instructions[i]
+		if instr.name != name || len(instr.args) < len(args) {
+			return false
+		}
+		for j, want := range args {
+			v, ok := argInt(instr.args[j])
+			if !ok || !v.IsInt64() || v.Int64() != want {
+				return false
+			}
+		}
+		return true
+	}
+	if len(d.instructions) != 4 || !is(0, "SETCP", 0) || !is(1, "DICTPUSHCONST", 19) ||
+		!is(2, "DICTIGETJMPZ") || !is(3, "THROWARG", 11) {
+		return DecompiledDict{}, false
+	}
+	dict, ok := d.instructions[1].args[1].(DecompiledDict)
+	return dict, ok
+}
+
+func (p *printer) fiftProgram(dict DecompiledDict) string {
+	builder := strings.Builder{}
+	builder.WriteString("PROGRAM{\n")
+	names := make([]string, len(dict.methods))
+	for i, method := range dict.methods {
+		// Asm.fif declares special methods by name with DECLPROC
+		if name, ok := specialMethodNames[method.id]; ok {
+			names[i] = name
+			builder.WriteString(fmt.Sprintf("  DECLPROC %s\n", name))
+			continue
+		}
+		names[i] = fmt.Sprintf("method_%d", method.id)
+		if name, ok := p.methodName(method.id); ok {
+			names[i] = name
+		}
+		builder.WriteString(fmt.Sprintf("  %d DECLMETHOD %s\n", method.id, names[i]))
+	}
+	for i, method := range dict.methods {
+		builder.WriteString(fmt.Sprintf("  %s PROC:<{\n", names[i]))
+		for _, instruction := range method.instructions {
+			builder.WriteString(p.fiftInstruction(instruction, 2))
+			builder.WriteString("\n")
+		}
+		builder.WriteString("  }>\n")
+	}
+	builder.WriteString("}END>c")
+	return builder.String()
+}
+
+func (p *printer) fiftInstruction(d DeserializedInstruction, depth int) string {
+	indent := strings.Repeat("  ", depth)
+	switch d.name {
+	case "ref":
+		// Code continues in the reference, append it to the builder as is
+		return p.annotate(indent+p.fiftArg(d.args[0], "refCodeSlice", depth)+" ref,", d)
+	case "UNKNOWN", "TRUNCATED":
+		return p.annotate(indent+p.fiftArg(d.args[0], "", depth)+" s,", d, d.name)
+	}
+
+	name, args := d.name, d.args
+	kinds := make([]string, len(args))
+	if alias, aliasArgs, ok := p.alias(d); ok {
+		name, args = alias, aliasArgs
+		kinds = make([]string, len(args))
+	} else {
+		if fiftName, ok := fiftNames[name]; ok {
+			name = fiftName
+		}
+		for i, arg := range d.instr.Layout.Args {
+			kinds[i] = string(arg.Empty)
+			if arg.Empty == "stack" && fiftPlainStackArgs[d.instr.Name] {
+				kinds[i] = "uint"
+			}
+		}
+		// Dictionary precedes its key length: D n DICTPUSHCONST
+		if len(args) == 2 && kinds[0] == "dict" {
+			dict, _ := args[1].(DecompiledDict)
+			keyLength, _ := args[0].(uint64)
+			return p.annotate(indent+p.fiftDict(dict, keyLength, depth)+"\n"+indent+fmt.Sprintf("%d %s", keyLength, name), d)
+		}
+		// Constant dispatch table: D PUSHREF, its key length is in the hint
+		if len(args) == 1 && kinds[0] == "refCodeSlice" {
+			if dict, ok := args[0].(DecompiledDict); ok {
+				var keyLength uint64
+				for _, hint := range d.hints {
+					if v, ok := strings.CutPrefix(hint, "keylen="); ok {
+						keyLength, _ = strconv.ParseUint(v, 10, 64)
+					}
+				}
+				return p.annotate(indent+p.fiftDict(dict, keyLength, depth)+"\n"+indent+name, d)
+			}
+		}
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString(indent)
+	for i, arg := range args {
+		builder.WriteString(p.fiftArg(arg, kinds[i], depth))
+		builder.WriteString(" ")
+	}
+	builder.WriteString(name)
+
+	// Fift can't express non-canonical encodings, so they are just noted
+	var comments []string
+	for _, hint := range d.hints {
+		comments = append(comments, "@"+hint)
+	}
+	return p.annotate(builder.String(), d, comments...)
+}
+
+// fiftDict builds the dictionary of methods with idict! on the Fift stack, prefix dictionaries with pfxdict!.
+func (p *printer) fiftDict(dict DecompiledDict, keyLength uint64, depth int) string {
+	indent := strings.Repeat("  ", depth)
+	builder := strings.Builder{}
+	builder.WriteString("dictnew")
+	for _, method := range dict.methods {
+		builder.WriteString("\n")
+		builder.WriteString(indent)
+		builder.WriteString(p.fiftArg(DecompiledCode{instructions: method.instructions}, "", depth))
+		if dict.prefix {
+			builder.WriteString(fmt.Sprintf("s %s rot %d pfxdict! drop", fiftBits(method.prefix), keyLength))
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("s %d rot %d idict! drop", method.id, keyLength))
+	}
+	return builder.String()
+}
+
+func (p *printer) fiftArg(arg any, kind string, depth int) string {
+	switch v := arg.(type) {
+	case StackRegister:
+		switch {
+		case kind == "uint":
+			return fmt.Sprintf("%d", v.idx)
+		case v.idx >= 0 && v.idx <= 15:
+			return fmt.Sprintf("s%d", v.idx)
+		case v.idx == -1 || v.idx == -2:
+			return fmt.Sprintf("s(%d)", v.idx)
+		}
+		return fmt.Sprintf("%d s()", v.idx)
+	case Control:
+		if v.idx <= 7 {
+			return v.String()
+		}
+		return fmt.Sprintf("%d c()", v.idx)
+	case Bits:
+		return fiftBits(v)
+	case *cell.Slice:
+		return fiftSlice(v)
+	case DecompiledCode:
+		if kind != "refCodeSlice" {
+			return p.fiftBlock(v, depth)
+		}
+		if p.labels[string(v.hash)] {
+			return cellLabel(v.hash)
+		}
+		return p.fiftBlock(v, depth) + "c"
+	}
+	return p.arg(arg, depth)
+}
+
+// fiftBlock prints the code as `<{ ... }>`.
+func (p *printer) fiftBlock(code DecompiledCode, depth int) string {
+	builder := strings.Builder{}
+	builder.WriteString("<{\n")
+	for _, instruction := range code.instructions {
+		builder.WriteString(p.fiftInstruction(instruction, depth+1))
+		builder.WriteString("\n")
+	}
+	builder.WriteString(strings.Repeat("  ", depth))
+	builder.WriteString("}>")
+	return builder.String()
+}
+
+// fiftBits formats bitstring as x{...} literal, short ones which don't fill hex digits as b{...}.
+func fiftBits(b Bits) string {
+	if b.length%4 == 0 || b.length > 12 {
+		return b.String()
+	}
+	builder := strings.Builder{}
+	builder.WriteString("b{")
+	for i := uint(0); i < b.length; i++ {
+		builder.WriteByte('0' + (b.data[i/8]>>(7-i%8))&1)
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// fiftSlice formats slice as literal or, if it has references, builds it with <b ... b> <s.
+func fiftSlice(s *cell.Slice) string {
+	s = s.Copy()
+	length, data, _ := s.RestBits()
+	bits := fiftBits(Bits{data: data, length: length})
+	if s.RefsNum() == 0 {
+		return bits
+	}
+	builder := strings.Builder{}
+	builder.WriteString("<b " + bits + " s,")
+	for s.RefsNum() > 0 {
+		builder.WriteString(" " + fiftCell(s.MustLoadRef().MustToCell()) + " ref,")
+	}
+	builder.WriteString(" b> <s")
+	return builder.String()
+}
+
+// fiftCell builds the cell with <b ... b>, special cells with <b ... b>spec.
+func fiftCell(c *cell.Cell) string {
+	builder := strings.Builder{}
+	s := c.BeginParse()
+	length, data, _ := s.RestBits()
+	builder.WriteString("<b " + fiftBits(Bits{data: data, length: length}) + " s,")
+	for i := range c.RefsNum() {
+		builder.WriteString(" " + fiftCell(c.MustPeekRef(int(i))) + " ref,")
+	}
+	if c.GetType() != cell.OrdinaryCellType {
+		builder.WriteString(" b>spec")
+	} else {
+		builder.WriteString(" b>")
+	}
+	return builder.String()
+}
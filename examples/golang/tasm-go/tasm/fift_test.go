@@ -0,0 +1,147 @@
+package tasm
+
+import (
+	"tasm-go/spec"
+	"testing"
+)
+
+// TestFiftAliases checks that instructions are printed by Fift aliases with matching fixed arguments,
+// and that the aliases are assembled back into the same instructions.
+func TestFiftAliases(t *testing.T) {
+	tvmSpec := spec.Default()
+	code, err := Assemble(tvmSpec, "PUSHINT_4 0 PUSHINT_4 -1 PUSHCTR c4 BLKSWAP 2 1 SETCONTARGS 0 3 SETCONTARGS 1 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompiled, err := DecompileCell(tvmSpec, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SETCONTARGS 1 3 has no alias, SETNUMARGS fixes the first argument to 0
+	expected := "FALSE\nTRUE\nPUSHROOT\n-ROLL 2\nSETNUMARGS 3\nSETCONTARGS 1 3\n"
+	text := decompiled.Format(PrintFiftAliases(tvmSpec))
+	if text != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, text)
+	}
+	assembled, err := Assemble(tvmSpec, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(assembled.Hash()) != string(code.Hash()) {
+		t.Errorf("expected cell %X, got %X", code.Hash(), assembled.Hash())
+	}
+
+	// ZERO and FALSE are both PUSHINT_4 0, the first alias in the specification is printed
+	zero, err := Assemble(tvmSpec, "ZERO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompiled, err = DecompileCell(tvmSpec, zero)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := decompiled.Format(PrintFiftAliases(tvmSpec)); text != "FALSE\n" {
+		t.Errorf("expected ZERO printed as FALSE, got %q", text)
+	}
+	if text := decompiled.String(); text != "PUSHINT_4 0\n" {
+		t.Errorf("expected PUSHINT_4 0 without aliases, got %q", text)
+	}
+}
+
+// TestPrintFift checks Fift scripts of a contract with the method dictionary, of a dictionary
+// built on the Fift stack and of code in references.
+func TestPrintFift(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			"program",
+			"SETCP 0 DICTPUSHCONST 19 [ 0 => { INC } 85143 => { PUSHINT_4 1 } -1 => { DEC } ] DICTIGETJMPZ THROWARG 11",
+			`"Asm.fif" include
+PROGRAM{
+  DECLPROC recv_external
+  DECLPROC recv_internal
+  85143 DECLMETHOD method_85143
+  recv_external PROC:<{
+    DEC
+  }>
+  recv_internal PROC:<{
+    INC
+  }>
+  method_85143 PROC:<{
+    1 PUSHINT
+  }>
+}END>c
+`,
+		},
+		{
+			"dictionary",
+			"DICTPUSHCONST 19 [ 0 => { INC } -1 => { DEC } ] DICTIGETJMP",
+			`"Asm.fif" include
+<{
+  dictnew
+  <{
+    DEC
+  }>s -1 rot 19 idict! drop
+  <{
+    INC
+  }>s 0 rot 19 idict! drop
+  19 DICTPUSHCONST
+  DICTIGETJMP
+}>c
+`,
+		},
+		{
+			"prefix dictionary",
+			"PFXDICTSWITCH 4 [ b{01} => { INC } b{1} => { DEC } ]",
+			`"Asm.fif" include
+<{
+  dictnew
+  <{
+    INC
+  }>s b{01} rot 4 pfxdict! drop
+  <{
+    DEC
+  }>s b{1} rot 4 pfxdict! drop
+  4 PFXDICTSWITCH
+}>c
+`,
+		},
+		{
+			"references",
+			"PUSHREF { INC } PUSHCONT_SHORT { DEC } IF ref { DEC }",
+			`"Asm.fif" include
+<{
+  <{
+    INC
+  }>c PUSHREF
+  <{
+    DEC
+  }> PUSHCONT
+  IF
+  <{
+    DEC
+  }>c ref,
+}>c
+`,
+		},
+	}
+	tvmSpec := spec.Default()
+	for _, test := range tests {
+		code, err := Assemble(tvmSpec, test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		decompiled, err := DecompileCell(tvmSpec, code)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if fift := decompiled.Format(PrintFift()); fift != test.expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", test.name, test.expected, fift)
+		}
+	}
+}
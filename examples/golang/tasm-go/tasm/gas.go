@@ -0,0 +1,353 @@
+package tasm
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"tasm-go/spec"
+	"tasm-go/spec/gas"
+)
+
+// GasEstimate is the result of EstimateGas.
+type GasEstimate struct {
+	// Gas of the code executed from its first instruction, e.g. recv_internal of Tact contracts
+	Code MethodGas
+	// Methods of dictionaries pushed by the code, e.g. by DICTPUSHCONST, in the order of appearance
+	Methods []MethodGas
+}
+
+// MethodGas is the gas of a method or of the whole code.
+type MethodGas struct {
+	// Key of the method in the dictionary, zero for the code
+	ID int64
+	// Gas of all paths from the first instruction until the method returns, jumps away or throws
+	Gas GasBounds
+	// Basic blocks of the method and of the continuations it pushes, e.g. bodies of IF and loops
+	Blocks []BlockGas
+}
+
+// BlockGas is the gas of a basic block, a straight-line sequence of instructions
+// which ends with a control flow instruction, an exception or the end of the cell.
+type BlockGas struct {
+	Instructions []DeserializedInstruction
+	// Gas of the instructions, excluding the continuations they execute
+	Gas GasBounds
+}
+
+// GasBounds are the lower and upper bounds of gas. Terms are amounts which can't be known
+// statically, e.g. iterations of loops, and they aren't included into the bounds.
+type GasBounds struct {
+	Min   int64
+	Max   int64
+	Terms []GasTerm
+}
+
+// GasTerm is a symbolic amount of gas of the instruction, e.g. `n * (58..133)`
+// for REPEAT or the formula `20000 + n * 11800` for BLS_PAIRING.
+type GasTerm struct {
+	Instruction DeserializedInstruction
+	Amount      string
+}
+
+func (t GasTerm) String() string {
+	return fmt.Sprintf("%s(%s)", t.Instruction.Name(), t.Amount)
+}
+
+// String formats bounds as `min..max + terms`, e.g. `126..201 + REPEAT(n * (40..40))`.
+func (b GasBounds) String() string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("%d..%d", b.Min, b.Max))
+	for _, term := range b.Terms {
+		builder.WriteString(" + ")
+		builder.WriteString(term.String())
+	}
+	return builder.String()
+}
+
+// add returns the gas of b followed by o.
+func (b GasBounds) add(o GasBounds) GasBounds {
+	return GasBounds{Min: b.Min + o.Min, Max: b.Max + o.Max, Terms: concatTerms(b.Terms, o.Terms)}
+}
+
+// join returns the gas of either b or o, terms common to both paths are kept once.
+func (b GasBounds) join(o GasBounds) GasBounds {
+	terms := b.Terms
+	for _, term := range o.Terms {
+		if !slices.ContainsFunc(b.Terms, term.same) {
+			terms = concatTerms(terms, []GasTerm{term})
+		}
+	}
+	return GasBounds{Min: min(b.Min, o.Min), Max: max(b.Max, o.Max), Terms: terms}
+}
+
+// same reports whether terms are of the same instruction in the code.
+func (t GasTerm) same(o GasTerm) bool {
+	a, b := t.Instruction.pos, o.Instruction.pos
+	return t.Amount == o.Amount && t.Instruction.name == o.Instruction.name &&
+		bytes.Equal(a.CellHash, b.CellHash) && a.Offset == b.Offset
+}
+
+func concatTerms(a, b []GasTerm) []GasTerm {
+	if len(b) == 0 {
+		return a
+	}
+	return append(slices.Clip(a), b...)
+}
+
+// EstimateGas statically estimates gas of the code and of the methods of its dictionaries.
+// Bounds follow all paths through the code: both sides of conditionals, calls of continuations
+// pushed right before the call, e.g. `PUSHCONT { ... } IF`, and implicit jumps to references.
+// Every cell may be loaded for the first time or reloaded, so CellLoad and CellReload give
+// the bounds. Loops, instructions with dynamic gas, calls of methods and of continuations
+// which aren't known statically, e.g. from DICTIGETJMP, are reported as terms.
+// Entries of prefix dictionaries have no IDs, so they aren't methods. A cell referenced several
+// times is walked once, and its blocks are listed once.
+func EstimateGas(code DecompiledCode) GasEstimate {
+	w := newGasWalker()
+	result := GasEstimate{Code: MethodGas{Gas: w.body(code.instructions), Blocks: w.blocks}}
+	for _, instruction := range code.instructions {
+		for _, arg := range instruction.args {
+			dict, ok := arg.(DecompiledDict)
+			if !ok || dict.prefix {
+				continue
+			}
+			for _, method := range dict.methods {
+				w := newGasWalker()
+				bounds := w.body(method.instructions)
+				result.Methods = append(result.Methods, MethodGas{ID: method.id, Gas: bounds, Blocks: w.blocks})
+			}
+		}
+	}
+	return result
+}
+
+// gasWalker collects basic blocks of the walked code.
+type gasWalker struct {
+	blocks []BlockGas
+	// Gas of the walked cells by their hashes
+	cells map[string]GasBounds
+}
+
+func newGasWalker() *gasWalker {
+	return &gasWalker{cells: make(map[string]GasBounds)}
+}
+
+// code returns the gas of the continuation, see body. The gas of a cell doesn't depend
+// on the path reaching it, so cells referenced several times are walked once.
+func (w *gasWalker) code(code DecompiledCode) GasBounds {
+	if code.hash == nil {
+		return w.body(code.instructions)
+	}
+	if bounds, ok := w.cells[string(code.hash)]; ok {
+		return bounds
+	}
+	bounds := w.body(code.instructions)
+	w.cells[string(code.hash)] = bounds
+	return bounds
+}
+
+// body returns the gas of the code from the first instruction until it returns, jumps away or throws.
+func (w *gasWalker) body(instructions []DeserializedInstruction) GasBounds {
+	// Gas of paths reaching the current instruction and of paths which left the code
+	var current, exits GasBounds
+	exited := false
+	exit := func(b GasBounds) {
+		if exited {
+			exits = exits.join(b)
+		} else {
+			exits, exited = b, true
+		}
+	}
+
+	// The block is reserved in advance to keep blocks in the code order, nested continuations follow it
+	blockIndex := -1
+	addToBlock := func(instruction DeserializedInstruction, cost GasBounds) {
+		if blockIndex < 0 {
+			blockIndex = len(w.blocks)
+			w.blocks = append(w.blocks, BlockGas{})
+		}
+		block := &w.blocks[blockIndex]
+		block.Instructions = append(block.Instructions, instruction)
+		block.Gas = block.Gas.add(cost)
+	}
+	endBlock := func() { blockIndex = -1 }
+
+	// Continuations pushed by the preceding instructions and their gas
+	var pushed []*DecompiledCode
+	known := make(map[*DecompiledCode]GasBounds)
+
+	for i, instruction := range instructions {
+		if instruction.name == "ref" {
+			// Implicit jump to the first reference, the other references are never executed
+			jump := GasBounds{Min: gas.ImplicitJump(true), Max: gas.ImplicitJump(false)}
+			endBlock()
+			addToBlock(instruction, jump)
+			endBlock()
+			exit(current.add(jump).add(w.code(instruction.args[0].(DecompiledCode))))
+			return exits
+		}
+		instr := instruction.instr
+		if instr == nil {
+			// UNKNOWN and TRUNCATED instructions throw
+			addToBlock(instruction, GasBounds{})
+			endBlock()
+			exit(current)
+			return exits
+		}
+
+		cost := instructionGas(instruction)
+		addToBlock(instruction, cost)
+		current = current.add(cost)
+
+		if instr.ControlFlow == nil {
+			if slices.Contains(instr.Effects, spec.EffectAlwaysThrow) {
+				endBlock()
+				exit(current)
+				return exits
+			}
+			if code, ok := instruction.PushedContinuation(); ok {
+				known[&code] = w.code(code)
+				pushed = append(pushed, &code)
+			} else {
+				pushed = nil
+			}
+			continue
+		}
+		endBlock()
+		var continuations []*GasBounds
+		for _, code := range instruction.Continuations(pushed) {
+			if code == nil {
+				continuations = append(continuations, nil)
+				continue
+			}
+			bounds, ok := known[code]
+			if !ok {
+				bounds = w.code(*code)
+			}
+			continuations = append(continuations, &bounds)
+		}
+		pushed = nil
+
+		if loop := spec.Loop(instr); loop != nil {
+			var iteration GasBounds
+			unknown := false
+			for _, c := range continuations {
+				if c == nil {
+					unknown = true
+				} else {
+					iteration = iteration.add(*c)
+				}
+			}
+			// Loops like REPEATEND take the rest of the code as the body and return after it
+			rest := loop.Args != nil && loop.Args.Body != nil && loop.Args.Body.Type == spec.Cc
+			if rest {
+				iteration = iteration.add(w.body(instructions[i+1:]))
+			}
+			count := "iterations"
+			if loop.Args != nil && loop.Args.Count != nil {
+				count = *loop.Args.Count
+			}
+			amount := fmt.Sprintf("%s * (%s)", count, iteration)
+			if unknown {
+				amount += " + unknown continuation"
+			}
+			current = current.add(GasBounds{Terms: []GasTerm{{instruction, amount}}})
+			if rest {
+				exit(current)
+				return exits
+			}
+			continue
+		}
+
+		// Branches are alternatives, a conditional instruction may also continue with the next one
+		var next []GasBounds
+		if spec.IsConditional(instr) {
+			next = append(next, current)
+		}
+		for k, branch := range instr.ControlFlow.Branches {
+			var target GasBounds
+			switch branch.Type {
+			case spec.PurpleVariable:
+				if k < len(continuations) && continuations[k] != nil {
+					target = *continuations[k]
+				} else {
+					target.Terms = []GasTerm{{instruction, "unknown continuation"}}
+				}
+				// Continuations without branches, e.g. exception handlers of TRY, may be executed after the branch
+				if len(instr.ControlFlow.Branches) == 1 {
+					for _, c := range continuations[min(1, len(continuations)):] {
+						if c != nil {
+							target = target.add(GasBounds{}.join(*c))
+						}
+					}
+				}
+			case spec.TypeRegister:
+				if branch.Index != nil && *branch.Index == 3 {
+					// CALLDICT and JMPDICT select the method by the argument
+					amount := "method from stack"
+					if len(instruction.args) > 0 {
+						amount = fmt.Sprintf("method %v", instruction.args[0])
+					}
+					target.Terms = []GasTerm{{instruction, amount}}
+				}
+			}
+			if spec.IsCall(branch) {
+				next = append(next, current.add(target))
+			} else {
+				exit(current.add(target))
+			}
+		}
+		if len(next) == 0 {
+			return exits
+		}
+		current = next[0]
+		for _, b := range next[1:] {
+			current = current.join(b)
+		}
+	}
+
+	endBlock()
+	exit(current.add(GasBounds{Min: gas.ImplicitRet, Max: gas.ImplicitRet}))
+	return exits
+}
+
+// instructionGas returns gas of the instruction without the continuations it executes.
+// Entries of the specification include the base gas of the shortest encoding, which is
+// replaced with the actual length, e.g. of PUSHSLICE data.
+func instructionGas(instruction DeserializedInstruction) GasBounds {
+	instr := instruction.instr
+	static := gas.Static(instruction.pos.Length)
+	base := gas.Static(uint(instr.Layout.SkipLen))
+	result := GasBounds{Min: static, Max: static}
+
+	var lo, hi int64
+	found := false
+	for _, entry := range instr.Description.Gas {
+		if entry.Formula != nil {
+			result.Terms = append(result.Terms, GasTerm{instruction, *entry.Formula})
+			continue
+		}
+		extra := entry.Value - base
+		if !found || extra < lo {
+			lo = extra
+		}
+		if !found || extra > hi {
+			hi = extra
+		}
+		found = true
+	}
+	// Entries usually describe loading and creation of cells, otherwise the effects are added
+	if slices.Contains(instr.Effects, spec.EffectCellLoad) && lo == hi {
+		lo, hi = lo+gas.CellReload, hi+gas.CellLoad
+	}
+	if slices.Contains(instr.Effects, spec.EffectCellCreate) && hi < gas.CellCreate {
+		lo, hi = lo+gas.CellCreate, hi+gas.CellCreate
+	}
+	if slices.Contains(instr.Effects, spec.EffectDynamicGas) && len(result.Terms) == 0 {
+		result.Terms = append(result.Terms, GasTerm{instruction, "dynamic"})
+	}
+	result.Min += lo
+	result.Max += hi
+	return result
+}
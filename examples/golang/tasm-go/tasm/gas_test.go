@@ -0,0 +1,90 @@
+package tasm
+
+import (
+	"tasm-go/spec"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// TestEstimateGas checks bounds over the paths of conditionals, loops, implicit jumps and dictionaries.
+func TestEstimateGas(t *testing.T) {
+	tests := []struct {
+		text string
+		// Bounds of the code and the number of its blocks
+		expected string
+		blocks   int
+		methods  []string
+	}{
+		// 2 * (10 + 8) and the implicit RET
+		{"INC INC", "41..41", 1, nil},
+		// Slices are charged by their length: 10 + 8 + 4 + 12
+		{"PUSHSLICE 8[AB]", "39..39", 1, nil},
+		// The body of IF may not be executed, then it returns too
+		{"PUSHINT_4 1 PUSHCONT_SHORT { INC } IF", "67..90", 2, nil},
+		{"PUSHINT_4 1 PUSHCONT_SHORT { INC } PUSHCONT_SHORT { DEC DEC } IFELSE", "124..142", 3, nil},
+		// The iterations are unknown, the body costs INC and its RET
+		{"PUSHINT_4 2 PUSHCONT_SHORT { INC } REPEAT", "67..67 + REPEAT(n * (23..23))", 2, nil},
+		// The referenced cell is loaded or reloaded by the implicit jump
+		{"INC ref { DEC }", "76..151", 3, nil},
+		// Methods are estimated separately, THROW costs the exception
+		{"DICTPUSHCONST 19 [ 0 => { INC } 1 => { THROW_SHORT 5 } ]", "39..39", 1, []string{"23..23", "76..76"}},
+	}
+	for _, test := range tests {
+		code, err := Assemble(spec.Default(), test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		decompiled, err := DecompileCell(spec.Default(), code)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		estimate := EstimateGas(decompiled)
+		if gas := estimate.Code.Gas.String(); gas != test.expected || len(estimate.Code.Blocks) != test.blocks {
+			t.Errorf("%s: expected %s in %d blocks, got %s in %d blocks", test.text, test.expected, test.blocks, gas, len(estimate.Code.Blocks))
+		}
+		if len(estimate.Methods) != len(test.methods) {
+			t.Errorf("%s: expected %d methods, got %d", test.text, len(test.methods), len(estimate.Methods))
+			continue
+		}
+		for i, method := range estimate.Methods {
+			if method.ID != int64(i) || method.Gas.String() != test.methods[i] {
+				t.Errorf("%s: expected method %d of %s, got %d of %s", test.text, i, test.methods[i], method.ID, method.Gas)
+			}
+		}
+	}
+}
+
+// ifrefChain builds n cells `IFREF next IFREF next`, so there are 2^n paths through the code.
+func ifrefChain(n int) *cell.Cell {
+	c := cell.BeginCell().MustStoreUInt(0xa4, 8).EndCell() // INC
+	for range n {
+		c = cell.BeginCell().MustStoreUInt(0xe300, 16).MustStoreRef(c).MustStoreUInt(0xe300, 16).MustStoreRef(c).EndCell()
+	}
+	return c
+}
+
+// TestEstimateGasSharedCells checks that cells referenced several times are walked once.
+func TestEstimateGasSharedCells(t *testing.T) {
+	const depth = 40
+	code, err := DecompileCell(spec.Default(), ifrefChain(depth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	estimate := EstimateGas(code)
+
+	// INC and RET, then both calls may load the cell: 2 * (26 + 100) and RET
+	expected := int64(23)
+	for range depth {
+		expected = 2*expected + 257
+	}
+	if gas := estimate.Code.Gas; gas.Min != 57 || gas.Max != expected {
+		t.Errorf("expected 57..%d, got %s", expected, gas)
+	}
+	// Two blocks of IFREF in each cell and INC
+	if len(estimate.Code.Blocks) != 2*depth+1 {
+		t.Errorf("expected %d blocks, got %d", 2*depth+1, len(estimate.Code.Blocks))
+	}
+}
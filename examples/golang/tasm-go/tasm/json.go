@@ -0,0 +1,252 @@
+package tasm
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// JSON encoding of the decompiled code. The code is an array of instructions:
+//
+//	{"name": "PUSHINT_4", "spec": "PUSHINT_4", "cell": "1f0a...", "offset": 0, "length": 8, "args": [{"type": "int", "value": "5"}]}
+//
+// cell, offset, length and refs are the Position of the instruction, refs are omitted if it has no references.
+// spec is omitted for pseudo-instructions, hints are omitted if the encoding is canonical.
+// Arguments are objects with the type field:
+//
+//	{"type": "int", "value": "-5"}                       integers are strings, since they can be up to 257 bits
+//	{"type": "stack", "index": 1}                        stack register s1
+//	{"type": "control", "index": 4}                      control register c4
+//	{"type": "bits", "hex": "a0", "bits": 3}             raw bits, aligned to the left
+//	{"type": "slice", "hex": "a0", "bits": 3, "refs": [{"hex": "", "bits": 0, "refs": []}]}
+//	{"type": "code", "code": [...]}                      nested code
+//	{"type": "code", "label": "cell_1a2b3c4d", "code": [...]}
+//	{"type": "code", "label": "cell_1a2b3c4d"}           cell referenced several times, its code is encoded once
+//	{"type": "dict", "methods": [{"id": 0, "code": [...]}]}
+//	{"type": "prefix_dict", "methods": [{"prefix": {"hex": "60", "bits": 3}, "code": [...]}]}
+//
+// The code of a shared cell follows its label at the first reference in the order of encoding,
+// the labels are the ones of DecompiledCode.Format.
+
+type jsonInstruction struct {
+	Name   string   `json:"name"`
+	Spec   string   `json:"spec,omitempty"`
+	Cell   string   `json:"cell"`
+	Offset uint     `json:"offset"`
+	Length uint     `json:"length"`
+	Refs   []int    `json:"refs,omitempty"`
+	Args   []any    `json:"args"`
+	Hints  []string `json:"hints,omitempty"`
+}
+
+type jsonRegister struct {
+	Type  string `json:"type"`
+	Index int64  `json:"index"`
+}
+
+type jsonInt struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type jsonBits struct {
+	Type string `json:"type,omitempty"`
+	Hex  string `json:"hex"`
+	Bits uint   `json:"bits"`
+}
+
+type jsonCell struct {
+	jsonBits
+	Refs []jsonCell `json:"refs"`
+}
+
+type jsonCode struct {
+	Type  string `json:"type"`
+	Label string `json:"label,omitempty"`
+	// []jsonInstruction, omitted for the repeated references to a shared cell, but not for empty code
+	Code any `json:"code,omitempty"`
+}
+
+type jsonDict struct {
+	Type    string `json:"type"`
+	Methods []any  `json:"methods"`
+}
+
+type jsonMethod struct {
+	ID   int64             `json:"id"`
+	Code []jsonInstruction `json:"code"`
+}
+
+type jsonPrefixMethod struct {
+	Prefix jsonBits          `json:"prefix"`
+	Code   []jsonInstruction `json:"code"`
+}
+
+// jsonEncoder converts the code into the JSON encoding, shared cells are encoded once.
+type jsonEncoder struct {
+	// Hashes of the shared cells, see sharedCells
+	shared map[string]bool
+	// Hashes of the shared cells already encoded
+	encoded map[string]bool
+}
+
+func newJSONEncoder(instructions ...DeserializedInstruction) *jsonEncoder {
+	e := &jsonEncoder{shared: make(map[string]bool), encoded: make(map[string]bool)}
+	for _, code := range sharedCells(DecompiledCode{instructions: instructions}) {
+		e.shared[string(code.hash)] = true
+	}
+	return e
+}
+
+func (d DecompiledCode) MarshalJSON() ([]byte, error) {
+	code, err := newJSONEncoder(d.instructions...).code(d.instructions)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(code)
+}
+
+func (d DeserializedInstruction) MarshalJSON() ([]byte, error) {
+	result, err := newJSONEncoder(d).instruction(d)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+func (m DecompiledMethod) MarshalJSON() ([]byte, error) {
+	code, err := newJSONEncoder(m.instructions...).code(m.instructions)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonMethod{ID: m.id, Code: code})
+}
+
+func (d DecompiledDict) MarshalJSON() ([]byte, error) {
+	var instructions []DeserializedInstruction
+	for _, method := range d.methods {
+		instructions = append(instructions, method.instructions...)
+	}
+	result, err := newJSONEncoder(instructions...).dict(d)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+func (e *jsonEncoder) code(instructions []DeserializedInstruction) ([]jsonInstruction, error) {
+	result := make([]jsonInstruction, len(instructions))
+	for i, instruction := range instructions {
+		var err error
+		if result[i], err = e.instruction(instruction); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (e *jsonEncoder) instruction(d DeserializedInstruction) (jsonInstruction, error) {
+	result := jsonInstruction{
+		Name:   d.name,
+		Cell:   hex.EncodeToString(d.pos.CellHash),
+		Offset: d.pos.Offset,
+		Length: d.pos.Length,
+		Refs:   d.pos.Refs,
+		Args:   make([]any, len(d.args)),
+		Hints:  d.hints,
+	}
+	if d.instr != nil {
+		result.Spec = d.instr.Name
+	}
+	for i, arg := range d.args {
+		v, err := e.arg(arg)
+		if err != nil {
+			return jsonInstruction{}, fmt.Errorf("instruction %s: %w", d.name, err)
+		}
+		result.Args[i] = v
+	}
+	return result, nil
+}
+
+func (e *jsonEncoder) dict(d DecompiledDict) (jsonDict, error) {
+	methods := make([]any, len(d.methods))
+	for i, method := range d.methods {
+		code, err := e.code(method.instructions)
+		if err != nil {
+			return jsonDict{}, err
+		}
+		if d.prefix {
+			prefix := jsonBits{Hex: hex.EncodeToString(method.prefix.data), Bits: method.prefix.length}
+			methods[i] = jsonPrefixMethod{Prefix: prefix, Code: code}
+		} else {
+			methods[i] = jsonMethod{ID: method.id, Code: code}
+		}
+	}
+	if d.prefix {
+		return jsonDict{Type: "prefix_dict", Methods: methods}, nil
+	}
+	return jsonDict{Type: "dict", Methods: methods}, nil
+}
+
+func (c Control) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRegister{Type: "control", Index: int64(c.idx)})
+}
+
+func (s StackRegister) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRegister{Type: "stack", Index: s.idx})
+}
+
+func (b Bits) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonBits{Type: "bits", Hex: hex.EncodeToString(b.data), Bits: b.length})
+}
+
+// arg converts the argument into a value with the JSON encoding described above.
+func (e *jsonEncoder) arg(arg any) (any, error) {
+	switch v := arg.(type) {
+	case int64, uint64, *big.Int:
+		return jsonInt{Type: "int", Value: fmt.Sprint(v)}, nil
+	case Control, StackRegister, Bits:
+		return v, nil
+	case DecompiledDict:
+		return e.dict(v)
+	case DecompiledCode:
+		result := jsonCode{Type: "code"}
+		if e.shared[string(v.hash)] {
+			result.Label = cellLabel(v.hash)
+			if e.encoded[string(v.hash)] {
+				return result, nil
+			}
+			e.encoded[string(v.hash)] = true
+		}
+		code, err := e.code(v.instructions)
+		if err != nil {
+			return nil, err
+		}
+		result.Code = code
+		return result, nil
+	case *cell.Slice:
+		c, err := v.Copy().ToCell()
+		if err != nil {
+			return nil, err
+		}
+		result := jsonCellOf(c)
+		result.Type = "slice"
+		return result, nil
+	}
+	return nil, fmt.Errorf("unsupported argument %T", arg)
+}
+
+func jsonCellOf(c *cell.Cell) jsonCell {
+	data, _ := c.BeginParse().LoadSlice(c.BitsSize())
+	result := jsonCell{
+		jsonBits: jsonBits{Hex: hex.EncodeToString(data), Bits: c.BitsSize()},
+		Refs:     make([]jsonCell, c.RefsNum()),
+	}
+	for i := range result.Refs {
+		result.Refs[i] = jsonCellOf(c.MustPeekRef(i))
+	}
+	return result
+}
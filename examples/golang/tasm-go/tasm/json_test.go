@@ -0,0 +1,82 @@
+package tasm
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"tasm-go/spec"
+	"testing"
+)
+
+// TestMarshalJSON checks the JSON encoding of instructions, their positions and arguments of each type.
+func TestMarshalJSON(t *testing.T) {
+	code, err := Assemble(spec.Default(), "PUSHINT_4 -5 PUSH s5 PUSHCTR c4 PUSHSLICE 2[8_] PUSHINT_LONG 7 @len=2 DICTPUSHCONST 19 [ -1 => { INC } ]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompiled, err := DecompileCell(spec.Default(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(decompiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var instructions []struct {
+		Name   string          `json:"name"`
+		Spec   string          `json:"spec"`
+		Cell   string          `json:"cell"`
+		Offset uint            `json:"offset"`
+		Length uint            `json:"length"`
+		Refs   []int           `json:"refs"`
+		Args   json.RawMessage `json:"args"`
+		Hints  []string        `json:"hints"`
+	}
+	if err := json.Unmarshal(data, &instructions); err != nil {
+		t.Fatal(err)
+	}
+
+	// The single method is in the root cell of the dictionary, after the label
+	dictRoot := code.MustPeekRef(0)
+	expected := []struct {
+		name           string
+		offset, length uint
+		args           string
+	}{
+		{"PUSHINT_4", 0, 8, `[{"type":"int","value":"-5"}]`},
+		{"PUSH", 8, 8, `[{"type":"stack","index":5}]`},
+		{"PUSHCTR", 16, 16, `[{"type":"control","index":4}]`},
+		{"PUSHSLICE", 32, 16, `[{"type":"slice","hex":"80","bits":2,"refs":[]}]`},
+		{"PUSHINT_LONG", 48, 48, `[{"type":"int","value":"7"}]`},
+		{
+			"DICTPUSHCONST", 96, 24,
+			`[{"type":"int","value":"19"},{"type":"dict","methods":[{"id":-1,"code":[{"name":"INC","spec":"INC","cell":"` +
+				hex.EncodeToString(dictRoot.Hash()) + `","offset":8,"length":8,"args":[]}]}]}]`,
+		},
+	}
+	if len(instructions) != len(expected) {
+		t.Fatalf("expected %d instructions, got %s", len(expected), data)
+	}
+	for i, instr := range instructions {
+		e := expected[i]
+		if instr.Name != e.name || instr.Spec != e.name || instr.Offset != e.offset || instr.Length != e.length {
+			t.Errorf("expected %s at %d of %d bits, got %s %s at %d of %d bits",
+				e.name, e.offset, e.length, instr.Name, instr.Spec, instr.Offset, instr.Length)
+		}
+		if instr.Cell != hex.EncodeToString(code.Hash()) {
+			t.Errorf("%s: expected cell %X, got %s", instr.Name, code.Hash(), instr.Cell)
+		}
+		if string(instr.Args) != e.args {
+			t.Errorf("%s: expected args %s, got %s", instr.Name, e.args, instr.Args)
+		}
+	}
+	if hints := instructions[4].Hints; len(hints) != 1 || hints[0] != "len=2" {
+		t.Errorf("expected hint len=2 of PUSHINT_LONG, got %v", hints)
+	}
+	if refs := instructions[5].Refs; len(refs) != 1 || refs[0] != 0 {
+		t.Errorf("expected reference 0 of DICTPUSHCONST, got %v", refs)
+	}
+	if instructions[0].Hints != nil || instructions[0].Refs != nil {
+		t.Errorf("expected no hints and references of PUSHINT_4, got %v and %v", instructions[0].Hints, instructions[0].Refs)
+	}
+}
@@ -0,0 +1,143 @@
+package tasm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// specialMethodNames are the names of methods which TVM runs by the negative IDs, and recv_internal.
+var specialMethodNames = map[int64]string{
+	0:  "recv_internal",
+	-1: "recv_external",
+	-2: "run_ticktock",
+	-3: "split_prepare",
+	-4: "split_install",
+}
+
+// standardGetMethods are get methods of the standard interfaces.
+var standardGetMethods = []string{
+	// Jetton minter and wallet, TEP-74 and TEP-89
+	"get_jetton_data", "get_wallet_address", "get_wallet_data",
+	// NFT collection and item, TEP-62, TEP-66 and SBT of TEP-85
+	"get_collection_data", "get_nft_address_by_index", "get_nft_content", "royalty_params",
+	"get_nft_data", "get_authority_address", "get_revoked_time",
+	// Wallets v3, v4 and v5
+	"seqno", "get_public_key", "get_subwallet_id", "is_plugin_installed", "get_plugin_list",
+	"is_signature_allowed", "get_extensions",
+}
+
+// MethodID returns the ID of the get method, as FunC and Tact compute it: `(crc16(name) & 0xffff) | 0x10000`.
+func MethodID(name string) int64 {
+	return int64(crc16([]byte(name))) | 0x10000
+}
+
+// crc16 is CRC-16/XMODEM.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// MethodNames resolves IDs of methods in dictionaries to names, e.g. for PrintMethodNames.
+type MethodNames struct {
+	names map[int64]string
+}
+
+// NewMethodNames creates the names of special methods, e.g. recv_internal, and the given get methods.
+func NewMethodNames(getMethods ...string) *MethodNames {
+	n := &MethodNames{names: make(map[int64]string)}
+	for id, name := range specialMethodNames {
+		n.names[id] = name
+	}
+	n.AddGetMethods(getMethods...)
+	return n
+}
+
+// StandardMethodNames creates the names of special methods and get methods of the standard
+// interfaces: jettons, NFTs and wallets v3, v4 and v5.
+func StandardMethodNames() *MethodNames {
+	return NewMethodNames(standardGetMethods...)
+}
+
+// AddGetMethods adds get methods by their names, see MethodID.
+func (n *MethodNames) AddGetMethods(names ...string) {
+	for _, name := range names {
+		n.names[MethodID(name)] = name
+	}
+}
+
+// Add adds the method with an explicit ID, e.g. declared with method_id(...) in FunC.
+func (n *MethodNames) Add(id int64, name string) {
+	n.names[id] = name
+}
+
+// Name returns the name of the method, false if it's unknown.
+func (n *MethodNames) Name(id int64) (string, bool) {
+	name, ok := n.names[id]
+	return name, ok
+}
+
+// abi is the part of Tact ABI files, which describes get methods.
+type abi struct {
+	Getters []struct {
+		Name     string `json:"name"`
+		MethodID *int64 `json:"methodId"`
+	} `json:"getters"`
+}
+
+// AddABI adds get methods of the contract ABI in JSON, e.g. the `.abi` file generated by Tact:
+//
+//	{"getters": [{"name": "get_jetton_data", "methodId": 106029}]}
+//
+// IDs of getters without methodId are computed from their names.
+func (n *MethodNames) AddABI(r io.Reader) error {
+	var contract abi
+	if err := json.NewDecoder(r).Decode(&contract); err != nil {
+		return fmt.Errorf("invalid ABI: %w", err)
+	}
+	for _, getter := range contract.Getters {
+		if getter.MethodID != nil {
+			n.Add(*getter.MethodID, getter.Name)
+		} else {
+			n.AddGetMethods(getter.Name)
+		}
+	}
+	return nil
+}
+
+// LoadABI adds get methods of the ABI file, see AddABI.
+func (n *MethodNames) LoadABI(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return n.AddABI(file)
+}
+
+// PrintMethodNames annotates methods of dictionaries with their names, e.g. `106029 => { // get_jetton_data`.
+// Fift scripts of PrintFift declare methods with the names instead of `method_ID`.
+func PrintMethodNames(names *MethodNames) PrintOption {
+	return func(p *printer) {
+		p.methodNames = names
+	}
+}
+
+// methodName returns the name of the method to print, false if it's unknown or names aren't printed.
+func (p *printer) methodName(id int64) (string, bool) {
+	if p.methodNames == nil {
+		return "", false
+	}
+	return p.methodNames.Name(id)
+}
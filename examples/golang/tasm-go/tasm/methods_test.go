@@ -0,0 +1,70 @@
+package tasm
+
+import (
+	"strings"
+	"tasm-go/spec"
+	"testing"
+)
+
+// TestMethodID checks IDs of get methods computed by FunC.
+func TestMethodID(t *testing.T) {
+	for name, expected := range map[string]int64{
+		"get_jetton_data":    106029,
+		"get_wallet_address": 103289,
+		"get_wallet_data":    97026,
+		"seqno":              85143,
+		"get_public_key":     78748,
+	} {
+		if id := MethodID(name); id != expected {
+			t.Errorf("%s: expected %d, got %d", name, expected, id)
+		}
+	}
+}
+
+// TestMethodNames checks names of special methods, standard get methods, ABI getters and explicit IDs.
+func TestMethodNames(t *testing.T) {
+	names := StandardMethodNames()
+	for id, expected := range map[int64]string{
+		0:      "recv_internal",
+		-1:     "recv_external",
+		-2:     "run_ticktock",
+		-3:     "split_prepare",
+		-4:     "split_install",
+		106029: "get_jetton_data",
+		85143:  "seqno",
+	} {
+		if name, ok := names.Name(id); !ok || name != expected {
+			t.Errorf("%d: expected %s, got %q", id, expected, name)
+		}
+	}
+	if name, ok := names.Name(1); ok {
+		t.Errorf("expected no name of 1, got %s", name)
+	}
+
+	err := names.AddABI(strings.NewReader(`{"getters": [{"name": "balance", "methodId": 12345}, {"name": "owner"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names.Add(7, "custom")
+	for id, expected := range map[int64]string{12345: "balance", MethodID("owner"): "owner", 7: "custom"} {
+		if name, ok := names.Name(id); !ok || name != expected {
+			t.Errorf("%d: expected %s, got %q", id, expected, name)
+		}
+	}
+	if err := names.AddABI(strings.NewReader(`{"getters": `)); err == nil {
+		t.Error("expected invalid ABI")
+	}
+
+	code, err := Assemble(spec.Default(), "DICTPUSHCONST 19 [ -4 => { INC } 106029 => { DEC } ]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompiled, err := DecompileCell(spec.Default(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := decompiled.Format(PrintMethodNames(names))
+	if !strings.Contains(text, "-4 => { // split_install") || !strings.Contains(text, "106029 => { // get_jetton_data") {
+		t.Errorf("expected names of methods in\n%s", text)
+	}
+}
@@ -0,0 +1,445 @@
+package tasm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// Parsing of the text printed by DecompiledCode.String():
+//
+//	NAME arg arg        instruction, number of arguments is defined by its layout
+//	s3, c4, -5          stack register, control register, integer
+//	{ ... }             code block
+//	[ 0 => { ... } ]    dictionary of methods
+//	[ b{01} => { ... } ] prefix dictionary, e.g. of PFXDICTSWITCH
+//	8[AB] -> { ... }    slice in cell.Dump format with optional references
+//	x{AB_}, b{101}      bitstring in Fift notation
+//	@len=3, @notag      hints for non-canonical encoding, follow the arguments,
+//	@keylen=19          and the key length of the dictionary pushed by PUSHREF
+//	cell_1a2b3c4d       label of a block, instead of { ... } of a reference
+//	cell_1a2b3c4d: { }  labelled block, defined at the top level, e.g. after the code
+//	// comment          ignored until the end of line
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenOpenBrace
+	tokenCloseBrace
+	tokenOpenBracket
+	tokenCloseBracket
+	tokenComma
+	tokenArrow     // =>
+	tokenRefsArrow // ->
+	tokenDump      // 8[AB]
+	tokenBits      // x{AB_}
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	line := 1
+	i := 0
+	for i < len(text) {
+		ch := text[i]
+		switch {
+		case ch == '\n':
+			line++
+			i++
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			i++
+		case strings.HasPrefix(text[i:], "//"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.IndexByte("{}[],", ch) >= 0:
+			kind := map[byte]tokenKind{
+				'{': tokenOpenBrace,
+				'}': tokenCloseBrace,
+				'[': tokenOpenBracket,
+				']': tokenCloseBracket,
+				',': tokenComma,
+			}[ch]
+			tokens = append(tokens, token{kind: kind, text: string(ch), line: line})
+			i++
+		default:
+			start := i
+			for i < len(text) && !isSeparator(text[i]) {
+				i++
+			}
+			word := text[start:i]
+
+			kind := tokenWord
+			switch {
+			case word == "=>":
+				kind = tokenArrow
+			case word == "->":
+				kind = tokenRefsArrow
+			case i < len(text) && text[i] == '{' && (word == "x" || word == "b"):
+				end := strings.IndexByte(text[i:], '}')
+				if end < 0 {
+					return nil, fmt.Errorf("line %d: unterminated bitstring", line)
+				}
+				i += end + 1
+				kind = tokenBits
+			case i < len(text) && text[i] == '[' && isDecimal(word):
+				end := strings.IndexByte(text[i:], ']')
+				if end < 0 {
+					return nil, fmt.Errorf("line %d: unterminated slice", line)
+				}
+				i += end + 1
+				// Special cells are marked with asterisk
+				if i < len(text) && text[i] == '*' {
+					i++
+				}
+				kind = tokenDump
+			}
+			tokens = append(tokens, token{kind: kind, text: text[start:i], line: line})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, line: line}), nil
+}
+
+func isSeparator(ch byte) bool {
+	return strings.IndexByte(" \t\r\n{}[],", ch) >= 0
+}
+
+func isDecimal(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// asmInstruction is a parsed instruction. Arguments have the same types as in
+// DeserializedInstruction, except integers, which are always *big.Int, and
+// slices, which are *cell.Cell.
+type asmInstruction struct {
+	name  string
+	args  []any
+	hints map[string]string
+	line  int
+}
+
+type asmBlock []asmInstruction
+
+type asmMethod struct {
+	id *big.Int
+	// Key of prefix dictionaries instead of id
+	prefix *Bits
+	code   asmBlock
+}
+
+type asmDict []asmMethod
+
+// asmLabel is a labelled block, all references to the label share it.
+type asmLabel struct {
+	name string
+	// Line of the first reference
+	line    int
+	code    asmBlock
+	defined bool
+	// Assembled cell, the block is assembled once
+	cell       *cell.Cell
+	assembling bool
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	// Returns number of arguments of the instruction, false if the name is unknown
+	argCount func(name string) (int, bool)
+	// Labelled blocks by name
+	labels map[string]*asmLabel
+}
+
+// parseCode parses the whole text: the code and labelled blocks.
+func (p *parser) parseCode() (asmBlock, error) {
+	p.labels = make(map[string]*asmLabel)
+	code, err := p.parseBlock(tokenEOF)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range p.labels {
+		if !label.defined {
+			return nil, fmt.Errorf("line %d: undefined label %s", label.line, label.name)
+		}
+	}
+	return code, nil
+}
+
+// label returns the labelled block by name, it's created by the first reference or definition.
+func (p *parser) label(name string, line int) *asmLabel {
+	label, ok := p.labels[name]
+	if !ok {
+		label = &asmLabel{name: name, line: line}
+		p.labels[name] = label
+	}
+	return label
+}
+
+// parseLabelled parses the block after the label definition `name:`.
+func (p *parser) parseLabelled(name string, line int) error {
+	label := p.label(name, line)
+	if label.defined {
+		return fmt.Errorf("line %d: label %s is already defined", line, name)
+	}
+	if _, err := p.expect(tokenOpenBrace, "{"); err != nil {
+		return err
+	}
+	code, err := p.parseBlock(tokenCloseBrace)
+	if err != nil {
+		return err
+	}
+	label.code, label.defined = code, true
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("line %d: expected %s, got %q", t.line, what, t.text)
+	}
+	return t, nil
+}
+
+// parseBlock parses instructions until the closing brace or the end of text.
+func (p *parser) parseBlock(end tokenKind) (asmBlock, error) {
+	var block asmBlock
+	for p.peek().kind != end {
+		t := p.next()
+		if t.kind != tokenWord {
+			return nil, fmt.Errorf("line %d: expected instruction, got %q", t.line, t.text)
+		}
+		if name, ok := strings.CutSuffix(t.text, ":"); ok && end == tokenEOF && labelRe.MatchString(name) {
+			if err := p.parseLabelled(name, t.line); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		count, ok := p.argCount(t.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown instruction %s", t.line, t.text)
+		}
+
+		instr := asmInstruction{name: t.text, line: t.line}
+		for range count {
+			arg, err := p.parseArg()
+			if err != nil {
+				return nil, err
+			}
+			instr.args = append(instr.args, arg)
+		}
+		for p.peek().kind == tokenWord && strings.HasPrefix(p.peek().text, "@") {
+			key, value, _ := strings.Cut(p.next().text[1:], "=")
+			if instr.hints == nil {
+				instr.hints = make(map[string]string)
+			}
+			instr.hints[key] = value
+		}
+		block = append(block, instr)
+	}
+	p.next()
+	return block, nil
+}
+
+var (
+	stackRegisterRe   = regexp.MustCompile(`^s(-?\d+)$`)
+	controlRegisterRe = regexp.MustCompile(`^c(\d+)$`)
+	labelRe           = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+func (p *parser) parseArg() (any, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenOpenBrace:
+		return p.parseBlock(tokenCloseBrace)
+	case tokenOpenBracket:
+		return p.parseDict()
+	case tokenDump:
+		return p.parseDump(t)
+	case tokenBits:
+		bits, err := parseBits(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", t.line, err)
+		}
+		return bits, nil
+	case tokenWord:
+		if m := stackRegisterRe.FindStringSubmatch(t.text); m != nil {
+			idx, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", t.line, err)
+			}
+			return StackRegister{idx: idx}, nil
+		}
+		if m := controlRegisterRe.FindStringSubmatch(t.text); m != nil {
+			idx, err := strconv.ParseUint(m[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", t.line, err)
+			}
+			return Control{idx: idx}, nil
+		}
+		if v, ok := new(big.Int).SetString(t.text, 0); ok {
+			return v, nil
+		}
+		if labelRe.MatchString(t.text) {
+			return p.label(t.text, t.line), nil
+		}
+	}
+	return nil, fmt.Errorf("line %d: unexpected argument %q", t.line, t.text)
+}
+
+func (p *parser) parseDict() (asmDict, error) {
+	var dict asmDict
+	for p.peek().kind != tokenCloseBracket {
+		var method asmMethod
+		t := p.next()
+		switch t.kind {
+		case tokenBits:
+			prefix, err := parseBits(t.text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", t.line, err)
+			}
+			method.prefix = &prefix
+		case tokenWord:
+			id, ok := new(big.Int).SetString(t.text, 0)
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid method id %q", t.line, t.text)
+			}
+			method.id = id
+		default:
+			return nil, fmt.Errorf("line %d: expected method id, got %q", t.line, t.text)
+		}
+		if len(dict) > 0 && (dict[0].prefix == nil) != (method.prefix == nil) {
+			return nil, fmt.Errorf("line %d: prefix and integer keys in the same dictionary", t.line)
+		}
+		if _, err := p.expect(tokenArrow, "=>"); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenOpenBrace, "{"); err != nil {
+			return nil, err
+		}
+		code, err := p.parseBlock(tokenCloseBrace)
+		if err != nil {
+			return nil, err
+		}
+		method.code = code
+		dict = append(dict, method)
+	}
+	p.next()
+	return dict, nil
+}
+
+// parseDump parses a cell in cell.Dump format, e.g. `12[ABC] -> { 8[FF], 0[] }`.
+func (p *parser) parseDump(t token) (*cell.Cell, error) {
+	text, special := strings.CutSuffix(t.text, "*")
+	sizeStr, data, _ := strings.Cut(strings.TrimSuffix(text, "]"), "[")
+	size, err := strconv.ParseUint(sizeStr, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", t.line, err)
+	}
+
+	// Dump omits the last hex digit if it has less than 4 significant bits
+	data = strings.TrimSuffix(data, "_")
+	if len(data)%2 == 1 {
+		data += "0"
+	}
+	bytes, err := hex.DecodeString(data)
+	if err != nil || uint64(len(bytes)*8) < size {
+		return nil, fmt.Errorf("line %d: invalid slice %s", t.line, t.text)
+	}
+
+	builder := cell.BeginCell()
+	if err := builder.StoreSlice(bytes, uint(size)); err != nil {
+		return nil, fmt.Errorf("line %d: %w", t.line, err)
+	}
+
+	if p.peek().kind == tokenRefsArrow {
+		p.next()
+		if _, err := p.expect(tokenOpenBrace, "{"); err != nil {
+			return nil, err
+		}
+		for {
+			ref, err := p.expect(tokenDump, "slice")
+			if err != nil {
+				return nil, err
+			}
+			refCell, err := p.parseDump(ref)
+			if err != nil {
+				return nil, err
+			}
+			if err := builder.StoreRef(refCell); err != nil {
+				return nil, fmt.Errorf("line %d: %w", ref.line, err)
+			}
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokenCloseBrace, "}"); err != nil {
+			return nil, err
+		}
+	}
+
+	c := builder.EndCell()
+	if special {
+		c.UnsafeModify(cell.LevelMask{}, true)
+	}
+	return c, nil
+}
+
+// parseBits parses bitstring in Fift notation: x{...} with optional completion tag `_`, or b{...}.
+func parseBits(text string) (Bits, error) {
+	body := text[2 : len(text)-1]
+	var bits []byte
+	if text[0] == 'b' {
+		for _, ch := range body {
+			if ch != '0' && ch != '1' {
+				return Bits{}, fmt.Errorf("invalid bitstring %s", text)
+			}
+			bits = append(bits, byte(ch-'0'))
+		}
+	} else {
+		digits, completed := strings.CutSuffix(body, "_")
+		for _, ch := range digits {
+			v, err := strconv.ParseUint(string(ch), 16, 8)
+			if err != nil {
+				return Bits{}, fmt.Errorf("invalid bitstring %s", text)
+			}
+			bits = append(bits, byte(v>>3)&1, byte(v>>2)&1, byte(v>>1)&1, byte(v)&1)
+		}
+		if completed {
+			// Remove trailing zeros and completion tag
+			for len(bits) > 0 && bits[len(bits)-1] == 0 {
+				bits = bits[:len(bits)-1]
+			}
+			if len(bits) > 0 {
+				bits = bits[:len(bits)-1]
+			}
+		}
+	}
+
+	return newBits(bits), nil
+}
@@ -0,0 +1,67 @@
+package tasm
+
+import (
+	"math/big"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// reader wraps cell.Slice and remembers the first error, so that a sequence of
+// loads can be checked once instead of after every call. After a failure all
+// subsequent loads return zero values.
+type reader struct {
+	slice *cell.Slice
+	err   error
+}
+
+func (r *reader) uint(bits uint) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := r.slice.LoadUInt(bits)
+	r.err = err
+	return v
+}
+
+func (r *reader) int(bits uint) int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := r.slice.LoadInt(bits)
+	r.err = err
+	return v
+}
+
+// bigInt loads signed integer of arbitrary length.
+// Unlike Slice.LoadBigInt it is not limited to 257 bits, PUSHINT_LONG can store up to 259 bits.
+func (r *reader) bigInt(bits uint) *big.Int {
+	data := r.bits(bits)
+	if r.err != nil {
+		return nil
+	}
+	v := new(big.Int).SetBytes(data)
+	// Data is left-aligned, shift it to the right
+	v.Rsh(v, uint(len(data)*8)-bits)
+	if bits > 0 && v.Bit(int(bits)-1) == 1 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), bits))
+	}
+	return v
+}
+
+func (r *reader) bits(bits uint) []byte {
+	if r.err != nil {
+		return nil
+	}
+	v, err := r.slice.LoadSlice(bits)
+	r.err = err
+	return v
+}
+
+func (r *reader) ref() *cell.Cell {
+	if r.err != nil {
+		return nil
+	}
+	v, err := r.slice.LoadRefCell()
+	r.err = err
+	return v
+}
@@ -0,0 +1,162 @@
+package tasm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"tasm-go/spec"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// RoundTripError describes the first difference between the original code cell
+// and the cell assembled from its printed disassembly.
+type RoundTripError struct {
+	// Indices of references from the root to the divergent cell
+	Path []int
+	// Hash of the divergent cell in the original tree
+	CellHash []byte
+	// Bit offset of the divergent instruction in the cell
+	Offset uint
+	// Divergent instruction as printed by the disassembler,
+	// empty if the cells differ only in references or the special flag
+	Instruction string
+	// Encodings of the instruction in the original and the reassembled cell
+	Original    Bits
+	Reassembled Bits
+}
+
+func (e *RoundTripError) Error() string {
+	path := make([]string, len(e.Path))
+	for i, idx := range e.Path {
+		path[i] = fmt.Sprint(idx)
+	}
+	msg := fmt.Sprintf("round trip mismatch in cell %X (path /%s), bit %d", e.CellHash, strings.Join(path, "/"), e.Offset)
+	if e.Instruction != "" {
+		msg += ", instruction " + e.Instruction
+	}
+	return fmt.Sprintf("%s: original %s, reassembled %s", msg, e.Original, e.Reassembled)
+}
+
+// RoundTrip checks that the code cell is disassembled into text, which is
+// assembled back into a bit-identical cell tree with the same hash.
+// It returns *RoundTripError with the first divergent instruction, or the
+// error of disassembling or assembling. Bits that are not valid instructions
+// are kept as UNKNOWN and TRUNCATED pseudo-instructions, see WithLenient.
+//
+// The printed text keeps the exact encoding: instruction names select the
+// encoding size, e.g. PUSHINT_8 or PUSHREFCONT, and non-canonical encodings of
+// arguments are described by hints, e.g. `PUSHSLICE x{A_} @len=2`.
+func RoundTrip(tvmSpec spec.Specification, code *cell.Cell) error {
+	decoder, err := NewDecoder(tvmSpec, WithLenient())
+	if err != nil {
+		return err
+	}
+	assembler, err := NewAssembler(tvmSpec)
+	if err != nil {
+		return err
+	}
+
+	decompiled, err := decoder.DecompileCell(code)
+	if err != nil {
+		return fmt.Errorf("disassemble: %w", err)
+	}
+	reassembled, err := assembler.Assemble(decompiled.String())
+	if err != nil {
+		return fmt.Errorf("assemble: %w", err)
+	}
+	return decoder.session().compareCells(code, reassembled, nil)
+}
+
+// compareCells finds the first divergent cell in the depth-first order, the decoder must be a session one.
+func (d *Decoder) compareCells(original, reassembled *cell.Cell, path []int) error {
+	if string(original.Hash()) == string(reassembled.Hash()) {
+		return nil
+	}
+	if original.BitsSize() == reassembled.BitsSize() && original.RefsNum() == reassembled.RefsNum() &&
+		string(original.BeginParse().MustLoadSlice(original.BitsSize())) == string(reassembled.BeginParse().MustLoadSlice(reassembled.BitsSize())) {
+		for i := range original.RefsNum() {
+			err := d.compareCells(original.MustPeekRef(int(i)), reassembled.MustPeekRef(int(i)), append(slices.Clone(path), int(i)))
+			if err != nil {
+				return err
+			}
+		}
+		// Cells with the same data and references can differ only by the special flag
+		return &RoundTripError{
+			Path:        path,
+			CellHash:    original.Hash(),
+			Original:    cellBits(original, 0, original.BitsSize()),
+			Reassembled: cellBits(reassembled, 0, reassembled.BitsSize()),
+		}
+	}
+
+	origSpans := d.instructionSpans(original)
+	reSpans := d.instructionSpans(reassembled)
+	for i, orig := range origSpans {
+		re := span{start: orig.start, end: orig.start}
+		if i < len(reSpans) {
+			re = reSpans[i]
+		}
+		origBits := cellBits(original, orig.start, orig.end)
+		reBits := cellBits(reassembled, re.start, re.end)
+		if orig.start != re.start || origBits.String() != reBits.String() {
+			return &RoundTripError{
+				Path:        path,
+				CellHash:    original.Hash(),
+				Offset:      orig.start,
+				Instruction: orig.text,
+				Original:    origBits,
+				Reassembled: reBits,
+			}
+		}
+	}
+	// All the original instructions are the same, so the reassembled cell has extra instructions
+	// or a different number of references
+	result := &RoundTripError{Path: path, CellHash: original.Hash(), Offset: original.BitsSize()}
+	if len(reSpans) > len(origSpans) {
+		extra := reSpans[len(origSpans)]
+		result.Instruction = extra.text
+		result.Reassembled = cellBits(reassembled, extra.start, extra.end)
+	}
+	return result
+}
+
+// span is a location of an instruction in the cell.
+type span struct {
+	start uint
+	end   uint
+	text  string
+}
+
+// instructionSpans decodes the top-level instructions of the cell without following implicit jumps.
+func (d *Decoder) instructionSpans(c *cell.Cell) []span {
+	var spans []span
+	slice := c.BeginParse()
+	for slice.BitsLeft() > 0 {
+		start := c.BitsSize() - slice.BitsLeft()
+		before := slice.Copy()
+		instruction, err := d.load(c, slice, source{cell: c})
+		if err != nil {
+			instruction = undecodedInstruction(before, err)
+			slice = before
+			slice.MustLoadSlice(slice.BitsLeft())
+		}
+		// Nested code is printed on the following lines, keep only the instruction itself
+		text, _, _ := strings.Cut(instruction.Print(0), "\n")
+		spans = append(spans, span{start: start, end: c.BitsSize() - slice.BitsLeft(), text: strings.TrimSpace(text)})
+	}
+	return spans
+}
+
+// cellBits returns bits of the cell in the range [start, end).
+func cellBits(c *cell.Cell, start, end uint) Bits {
+	slice := c.BeginParse()
+	if end > c.BitsSize() {
+		end = c.BitsSize()
+	}
+	if start >= end {
+		return Bits{}
+	}
+	slice.MustLoadSlice(start)
+	return Bits{data: slice.MustLoadSlice(end - start), length: end - start}
+}
@@ -0,0 +1,82 @@
+package tasm
+
+import (
+	"errors"
+	"tasm-go/spec"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// TestRoundTrip checks code which is printed and assembled back into the same cell,
+// including bits which aren't valid instructions.
+func TestRoundTrip(t *testing.T) {
+	tvmSpec := spec.Default()
+	if err := RoundTrip(tvmSpec, loadJetton(t)); err != nil {
+		t.Errorf("jetton minter: %v", err)
+	}
+
+	// INC, then the invalid opcode F8FF and 3 bits left, printed as UNKNOWN
+	invalid := cell.BeginCell().MustStoreUInt(0xa4, 8).MustStoreUInt(0xf8ff, 16).MustStoreUInt(1, 3).EndCell()
+	if err := RoundTrip(tvmSpec, invalid); err != nil {
+		t.Errorf("invalid opcode: %v", err)
+	}
+	// SETCP_SHORT -1, then 3 bits of an incomplete opcode, printed as TRUNCATED
+	truncated := cell.BeginCell().MustStoreUInt(0xffff, 16).MustStoreUInt(1, 3).EndCell()
+	if err := RoundTrip(tvmSpec, truncated); err != nil {
+		t.Errorf("truncated opcode: %v", err)
+	}
+}
+
+// TestRoundTripMismatch checks the difference reported for a dictionary with a non-canonical label,
+// which isn't described by hints: the dictionary cell is decoded as code to find the instruction.
+func TestRoundTripMismatch(t *testing.T) {
+	// Key 0x05 of 8 bits with hml_short$0 label, hml_long$10 is shorter
+	dict := cell.BeginCell().MustStoreUInt(0b0111111110, 10).MustStoreUInt(0x05, 8).MustStoreUInt(0xa4, 8).EndCell()
+	// DICTPUSHCONST 8
+	code := cell.BeginCell().MustStoreUInt(0x3d29, 14).MustStoreRef(dict).MustStoreUInt(8, 10).EndCell()
+
+	err := RoundTrip(spec.Default(), code)
+	var mismatch *RoundTripError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected RoundTripError, got %v", err)
+	}
+	if len(mismatch.Path) != 1 || mismatch.Path[0] != 0 || string(mismatch.CellHash) != string(dict.Hash()) {
+		t.Errorf("expected mismatch in the dictionary cell %X, got %v", dict.Hash(), err)
+	}
+	// The label starts with 0111 1111, PUSHINT_4 -1
+	if mismatch.Offset != 0 || mismatch.Instruction != "PUSHINT_4 -1" {
+		t.Errorf("expected PUSHINT_4 -1 at bit 0, got %q at bit %d", mismatch.Instruction, mismatch.Offset)
+	}
+	if mismatch.Original.String() != "x{7F}" || mismatch.Reassembled.String() != "x{A0}" {
+		t.Errorf("expected x{7F} reassembled as x{A0}, got %s and %s", mismatch.Original, mismatch.Reassembled)
+	}
+}
+
+// TestRoundTripDecodesDivergentReferences checks a dictionary with a non-canonical label: the leaf
+// is reassembled with the canonical label, and the divergent leaf is decoded again to report it.
+// The label and the value make PUSHREF there, which decodes the reference of the leaf.
+func TestRoundTripDecodesDivergentReferences(t *testing.T) {
+	// PUSH s2 NOP, the value continues in the reference { NOP }
+	value := func(b *cell.Builder) *cell.Builder {
+		return b.MustStoreUInt(0x2200, 16).MustStoreRef(cell.BeginCell().MustStoreUInt(0x00, 8).EndCell())
+	}
+	// Keys are 1 bit long, so the leaves have empty labels: hml_long$10 n:(#<= 0) is non-canonical
+	nonCanonical := value(cell.BeginCell().MustStoreUInt(0b10, 2)).EndCell()
+	canonical := value(cell.BeginCell().MustStoreUInt(0b00, 2)).EndCell()
+	dict := cell.BeginCell().MustStoreUInt(0b00, 2).MustStoreRef(nonCanonical).MustStoreRef(canonical).EndCell()
+	// DICTPUSHCONST 1
+	code := cell.BeginCell().MustStoreUInt(0x3d29, 14).MustStoreRef(dict).MustStoreUInt(1, 10).EndCell()
+
+	err := RoundTrip(spec.Default(), code)
+	var mismatch *RoundTripError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected RoundTripError, got %v", err)
+	}
+	if string(mismatch.CellHash) != string(nonCanonical.Hash()) || len(mismatch.Path) != 2 {
+		t.Errorf("expected mismatch in the first leaf %X, got %v", nonCanonical.Hash(), err)
+	}
+	if mismatch.Instruction != "PUSHREF {" {
+		t.Errorf("expected PUSHREF decoded from the label, got %q", mismatch.Instruction)
+	}
+}
@@ -0,0 +1,719 @@
+// Package stack infers the height of the stack and the possible types of its values
+// for every instruction of the disassembled code.
+//
+// The analysis is an abstract interpretation: instructions pop and push values according
+// to their signatures, see spec/signature, stack manipulation instructions, e.g. XCHG_0I or BLKSWAP,
+// move values by their register arguments, and continuations are followed when they are
+// known statically, like in the tasm/cfg package. The stack of a method is open: values of the
+// caller are taken as needed, see State.Inputs. Underflows of closed stacks, values of wrong
+// types and constants out of the range of the signature are reported as problems.
+//
+// When the height can't be known, e.g. after DICTGET, which pushes a different number of values
+// when the key is missing, the analysis goes on with the values pushed after it, see State.Unknown.
+package stack
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"tasm-go/spec"
+	"tasm-go/spec/signature"
+	"tasm-go/tasm"
+)
+
+// Problem is an error found by the analysis, e.g. a stack underflow.
+type Problem struct {
+	Instruction tasm.DeserializedInstruction
+	Message     string
+}
+
+func (p Problem) String() string {
+	return p.Instruction.Name() + ": " + p.Message
+}
+
+// Result is the inferred stack of the code.
+type Result struct {
+	// Stacks after instructions by their location in the code
+	states   map[location]State
+	Problems []Problem
+}
+
+type location struct {
+	hash   string
+	offset uint
+}
+
+func locationOf(instruction tasm.DeserializedInstruction) location {
+	pos := instruction.Position()
+	return location{string(pos.CellHash), pos.Offset}
+}
+
+// After returns the stack after the instruction, false if the instruction is never executed,
+// e.g. dead code after a jump. The stacks of all paths to the instruction are joined.
+func (r *Result) After(instruction tasm.DeserializedInstruction) (State, bool) {
+	s, ok := r.states[locationOf(instruction)]
+	return s, ok
+}
+
+// PrintComments annotates instructions with the inferred stack after them and the found problems,
+// e.g. `// [.. Int Slice]`.
+func (r *Result) PrintComments() tasm.PrintOption {
+	problems := make(map[location][]string)
+	for _, problem := range r.Problems {
+		at := locationOf(problem.Instruction)
+		problems[at] = append(problems[at], "error: "+problem.Message)
+	}
+	return tasm.PrintComments(func(instruction tasm.DeserializedInstruction) string {
+		if instruction.Spec() == nil {
+			return ""
+		}
+		var comments []string
+		if s, ok := r.After(instruction); ok {
+			comments = append(comments, s.String())
+		}
+		comments = append(comments, problems[locationOf(instruction)]...)
+		return strings.Join(comments, " ")
+	})
+}
+
+// Option configures Analyze.
+type Option func(*analyzer)
+
+// WithInitialStack sets the types of values on the stack when the code starts, the stack is closed,
+// so popping more values is reported as underflow. By default the stack is open and empty.
+func WithInitialStack(types ...Type) Option {
+	return func(a *analyzer) {
+		a.initial = state{}
+		for _, t := range types {
+			a.initial.values = append(a.initial.values, value{t: t})
+		}
+	}
+}
+
+// Analyze infers the stack for every instruction of the code and of methods of its dictionaries,
+// which start with an open empty stack. Continuations which are pushed but not executed by
+// the following instructions, e.g. saved to c0, also start with an open empty stack.
+// A cell referenced several times is analyzed with the stacks of all paths to it joined,
+// again only when the joined stack changes.
+func Analyze(code tasm.DecompiledCode, opts ...Option) *Result {
+	a := &analyzer{
+		result:   &Result{states: make(map[location]State)},
+		initial:  state{open: true},
+		cells:    make(map[string]*cellState),
+		reported: make(map[reported]bool),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.body(code.Instructions(), a.initial.clone())
+	return a.result
+}
+
+type analyzer struct {
+	result  *Result
+	initial state
+	// Stacks of the analyzed cells by their hashes
+	cells map[string]*cellState
+	// Problems found at the locations, which are reported once
+	reported map[reported]bool
+}
+
+// cellState is the joined stack of the paths to the cell and the stack when the cell returns.
+type cellState struct {
+	entry   state
+	exit    state
+	returns bool
+}
+
+type reported struct {
+	at      location
+	message string
+}
+
+func (a *analyzer) report(instruction tasm.DeserializedInstruction, format string, args ...any) {
+	problem := Problem{Instruction: instruction, Message: fmt.Sprintf(format, args...)}
+	key := reported{locationOf(instruction), problem.Message}
+	if a.reported[key] {
+		return
+	}
+	a.reported[key] = true
+	a.result.Problems = append(a.result.Problems, problem)
+}
+
+func (a *analyzer) record(instruction tasm.DeserializedInstruction, s state) {
+	at := locationOf(instruction)
+	if previous, ok := a.result.states[at]; ok {
+		s = join(s, importState(previous))
+	}
+	a.result.states[at] = s.export()
+}
+
+// importState converts the recorded stack back for joining, constants are lost.
+func importState(s State) state {
+	values := make([]value, len(s.Values))
+	for i, t := range s.Values {
+		values[i] = value{t: t}
+	}
+	return state{values: values, inputs: s.Inputs, open: s.Open, lost: s.Unknown}
+}
+
+// detached analyzes code executed in an unknown context, e.g. a method.
+func (a *analyzer) detached(code tasm.DecompiledCode) {
+	a.code(code, state{open: true})
+}
+
+// code analyzes the continuation like body. A cell is analyzed again only if the stack joined
+// with the stacks of the previous paths to it changes, otherwise its previous result is returned.
+func (a *analyzer) code(code tasm.DecompiledCode, current state) (state, bool) {
+	hash := code.CellHash()
+	if hash == nil {
+		return a.body(code.Instructions(), current)
+	}
+	if previous, ok := a.cells[string(hash)]; ok {
+		current = join(previous.entry, current)
+		if current.equal(previous.entry) {
+			return previous.exit.clone(), previous.returns
+		}
+	}
+	exit, returns := a.body(code.Instructions(), current.clone())
+	a.cells[string(hash)] = &cellState{entry: current, exit: exit, returns: returns}
+	return exit.clone(), returns
+}
+
+// body analyzes the code and returns the stack when it returns, false if it never returns, e.g. always throws.
+func (a *analyzer) body(instructions []tasm.DeserializedInstruction, current state) (state, bool) {
+	var exits state
+	exited := false
+	exit := func(s state) {
+		if exited {
+			exits = join(exits, s)
+		} else {
+			exits, exited = s, true
+		}
+	}
+
+	// Continuations pushed by the preceding instructions
+	var pushed []*tasm.DecompiledCode
+	detachPushed := func(consumed int) {
+		for _, code := range pushed[:max(len(pushed)-consumed, 0)] {
+			a.detached(*code)
+		}
+		pushed = nil
+	}
+
+	for i, instruction := range instructions {
+		instr := instruction.Spec()
+		if instruction.Name() == "ref" {
+			detachPushed(0)
+			if s, ok := a.code(instruction.Args()[0].(tasm.DecompiledCode), current); ok {
+				exit(s)
+			}
+			return exits, exited
+		}
+		if instr == nil {
+			// UNKNOWN and TRUNCATED instructions throw
+			detachPushed(0)
+			return exits, exited
+		}
+
+		a.apply(instruction, &current)
+
+		if instr.ControlFlow == nil {
+			a.record(instruction, current)
+			for _, arg := range instruction.Args() {
+				if dict, ok := arg.(tasm.DecompiledDict); ok {
+					for _, method := range dict.Methods() {
+						a.body(method.Instructions(), state{open: true})
+					}
+				}
+			}
+			if code, ok := instruction.PushedContinuation(); ok {
+				pushed = append(pushed, &code)
+				continue
+			}
+			detachPushed(0)
+			if slices.Contains(instr.Effects, spec.EffectAlwaysThrow) {
+				return exits, exited
+			}
+			continue
+		}
+
+		continuations := instruction.Continuations(pushed)
+		detachPushed(len(spec.ContinuationInputs(instr)))
+
+		if loop := spec.Loop(instr); loop != nil {
+			restBody := loop.Args != nil && loop.Args.Body != nil && loop.Args.Body.Type == spec.Cc
+			var bodies []func(state) (state, bool)
+			for _, code := range continuations {
+				if code == nil {
+					bodies = append(bodies, nil)
+				} else {
+					bodies = append(bodies, func(s state) (state, bool) { return a.code(*code, s) })
+				}
+			}
+			if restBody {
+				rest := instructions[i+1:]
+				bodies = append(bodies, func(s state) (state, bool) { return a.body(rest, s) })
+			}
+			after := a.loop(instruction, *loop.Name, bodies, current)
+			if restBody {
+				// The loop returns after the rest of the code
+				a.record(instruction, current)
+				exit(after)
+				return exits, exited
+			}
+			current = after
+			a.record(instruction, current)
+			continue
+		}
+
+		// Branches are alternatives, a conditional instruction may also continue with the next one
+		var next []state
+		if spec.IsConditional(instr) {
+			next = append(next, current.clone())
+		}
+		for k, branch := range instr.ControlFlow.Branches {
+			result, returns := unknown(), true
+			switch branch.Type {
+			case spec.PurpleVariable:
+				switch {
+				case k >= len(continuations) || continuations[k] == nil:
+				case passesArguments(instr):
+					// The continuation gets a new stack of the passed values, e.g. for CALLXARGS
+					a.detached(*continuations[k])
+				default:
+					result, returns = a.code(*continuations[k], current.clone())
+				}
+			case spec.TypeRegister:
+				if *branch.Index != 3 && !spec.IsCall(branch) {
+					// RET and RETALT return the current stack
+					result = current.clone()
+				}
+			}
+			switch {
+			case !returns:
+			case spec.IsCall(branch):
+				next = append(next, result)
+			default:
+				exit(result)
+			}
+		}
+		// Exception handlers, e.g. of TRY, get the stack of the instruction with the argument and the exit code
+		if len(instr.ControlFlow.Branches) == 1 {
+			for _, handler := range continuations[min(1, len(continuations)):] {
+				if handler == nil || passesArguments(instr) {
+					if handler != nil {
+						a.detached(*handler)
+					}
+					next = append(next, unknown())
+					continue
+				}
+				s := current.clone()
+				s.values = append(s.values, value{t: Any}, value{t: Int})
+				if result, ok := a.code(*handler, s); ok {
+					next = append(next, result)
+				}
+			}
+		}
+		if len(next) == 0 {
+			// The instruction jumps away, e.g. JMPX
+			a.record(instruction, current)
+			return exits, exited
+		}
+		current = next[0]
+		for _, s := range next[1:] {
+			current = join(current, s)
+		}
+		a.record(instruction, current)
+	}
+
+	detachPushed(0)
+	exit(current)
+	return exits, exited
+}
+
+// passesArguments reports whether the instruction passes a number of values to the continuation
+// instead of the whole stack, e.g. CALLXARGS and TRYARGS.
+func passesArguments(instr *spec.Instruction) bool {
+	sig, ok := signature.Of(instr)
+	return ok && slices.ContainsFunc(sig.Inputs, func(entry spec.StackEntry) bool { return entry.Type == spec.Array })
+}
+
+// loop analyzes bodies of the loop and returns the stack after it. The condition of WHILE and
+// the body of UNTIL leave the flag on the stack. Loops which change the height have unknown stacks.
+func (a *analyzer) loop(instruction tasm.DeserializedInstruction, name spec.ContinuationName, bodies []func(state) (state, bool), current state) state {
+	run := func(body func(state) (state, bool), s state, flag bool) state {
+		if body == nil {
+			return unknown()
+		}
+		result, ok := body(s.clone())
+		if !ok {
+			return unknown()
+		}
+		if flag {
+			m := &machine{state: &result}
+			if v, ok := m.pop(); !ok {
+				a.report(instruction, "%s", m.err)
+				return unknown()
+			} else if v.t&Int == 0 {
+				a.report(instruction, "flag is %s, expected Int", v.t)
+			}
+		}
+		return result
+	}
+
+	switch {
+	case name == spec.While && len(bodies) == 2:
+		afterCondition := run(bodies[0], current, true)
+		afterBody := run(bodies[1], afterCondition, false)
+		return join(afterCondition, afterBody)
+	case name == spec.Until && len(bodies) == 1:
+		afterBody := run(bodies[0], current, true)
+		return join(current, afterBody)
+	case name == spec.Repeat && len(bodies) == 1:
+		afterBody := run(bodies[0], current, false)
+		return join(current, afterBody)
+	}
+	// AGAIN exits only by exceptions and breaks, e.g. RETALT
+	for _, body := range bodies {
+		run(body, current, false)
+	}
+	return unknown()
+}
+
+// apply executes the instruction on the stack.
+func (a *analyzer) apply(instruction tasm.DeserializedInstruction, s *state) {
+	m := &machine{state: s}
+	if !a.stackInstruction(instruction, m) {
+		sig, ok := signature.Of(instruction.Spec())
+		if !ok {
+			s.forget()
+			return
+		}
+		a.signature(instruction, sig, m)
+	}
+	if m.err != nil {
+		a.report(instruction, "%s", m.err)
+		s.forget()
+	}
+}
+
+// signature pops the inputs of the instruction, checking their types and the ranges of constants,
+// and pushes its outputs. Outputs named like inputs keep types of the inputs if the signature
+// doesn't narrow them, e.g. for SWAP.
+func (a *analyzer) signature(instruction tasm.DeserializedInstruction, sig signature.Signature, m *machine) {
+	args := instruction.Args()
+	inputs := make(map[string]value)
+	for i := len(sig.Inputs) - 1; i >= 0; i-- {
+		entry := sig.Inputs[i]
+		switch entry.Type {
+		case spec.TypeSimple, spec.Const:
+			v, ok := m.pop()
+			if !ok {
+				return
+			}
+			expected := typeOf(entry.ValueTypes)
+			if entry.Type == spec.Const {
+				expected = Int | Null
+			}
+			if v.t&expected == 0 {
+				a.report(instruction, "%s is %s, expected %s", entryName(entry, len(sig.Inputs)-1-i), v.t, expected)
+			} else {
+				v.t &= expected
+			}
+			if r := entry.Range; r != nil && v.known && (float64(v.constant) < r.Min || float64(v.constant) > r.Max) {
+				a.report(instruction, "%s is %d, expected %g..%g", entryName(entry, len(sig.Inputs)-1-i), v.constant, r.Min, r.Max)
+			}
+			if entry.Name != nil {
+				inputs[*entry.Name] = v
+			}
+		case spec.Array:
+			n, ok := arrayLength(sig, entry, args, inputs)
+			if !ok {
+				m.forget()
+				return
+			}
+			m.drop(n * len(entry.ArrayEntry))
+		default:
+			m.forget()
+			return
+		}
+	}
+
+	outputs, ok := a.outputs(sig, sig.Outputs, args, inputs)
+	if !ok {
+		m.forget()
+		return
+	}
+	// Integer constants are tracked for stack instructions like ROLLX
+	if strings.HasPrefix(instruction.Name(), "PUSHINT") && len(outputs) == 1 && len(args) == 1 {
+		outputs[0].constant, outputs[0].known = integer(args[0])
+	}
+	for _, v := range outputs {
+		m.push(v)
+	}
+}
+
+// outputs returns the pushed values, false if their number isn't known statically.
+func (a *analyzer) outputs(sig signature.Signature, entries []spec.StackEntry, args []any, inputs map[string]value) ([]value, bool) {
+	var result []value
+	for _, entry := range entries {
+		switch entry.Type {
+		case spec.TypeSimple:
+			v := value{t: typeOf(entry.ValueTypes)}
+			if entry.Name != nil {
+				if input, ok := inputs[*entry.Name]; ok && input.t&v.t != 0 {
+					if v.t == Any {
+						v = input
+					} else {
+						v.t &= input.t
+					}
+				}
+			}
+			result = append(result, v)
+		case spec.Const:
+			v := value{t: Int}
+			if entry.ValueType != nil && *entry.ValueType == spec.ConstantTypeNull {
+				v.t = Null
+			} else if entry.Value != nil && entry.Value.Integer != nil {
+				v.constant, v.known = *entry.Value.Integer, true
+			}
+			result = append(result, v)
+		case spec.Array:
+			n, ok := arrayLength(sig, entry, args, inputs)
+			if !ok {
+				return nil, false
+			}
+			item, ok := a.outputs(sig, entry.ArrayEntry, args, nil)
+			if !ok {
+				return nil, false
+			}
+			for range n {
+				result = append(result, item...)
+			}
+		case spec.Conditional:
+			// Arms of the same size are joined value by value
+			arms := make([][]spec.StackEntry, 0, len(entry.Match)+1)
+			for _, arm := range entry.Match {
+				arms = append(arms, arm.Stack)
+			}
+			if entry.Else != nil {
+				arms = append(arms, entry.Else)
+			}
+			var joined []value
+			for k, arm := range arms {
+				values, ok := a.outputs(sig, arm, args, inputs)
+				if !ok || k > 0 && len(values) != len(joined) {
+					return nil, false
+				}
+				if k == 0 {
+					joined = values
+					continue
+				}
+				for j := range joined {
+					joined[j] = value{t: joined[j].t | values[j].t}
+				}
+			}
+			result = append(result, joined...)
+		default:
+			return nil, false
+		}
+	}
+	return result, true
+}
+
+// arrayLength returns the length of the array from the operand or the constant on the stack.
+func arrayLength(sig signature.Signature, entry spec.StackEntry, args []any, inputs map[string]value) (int, bool) {
+	if entry.LengthVar == nil {
+		return 0, false
+	}
+	if n, ok := sig.Operand(*entry.LengthVar, args); ok && n >= 0 {
+		return int(n), true
+	}
+	if v, ok := inputs[*entry.LengthVar]; ok && v.known && v.constant >= 0 {
+		return int(v.constant), true
+	}
+	return 0, false
+}
+
+func entryName(entry spec.StackEntry, depth int) string {
+	if entry.Name != nil {
+		return *entry.Name
+	}
+	return fmt.Sprintf("s%d", depth)
+}
+
+// integer converts an integer argument of the instruction.
+func integer(arg any) (int64, bool) {
+	switch v := arg.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), v <= 1<<63-1
+	case *big.Int:
+		return v.Int64(), v.IsInt64()
+	case tasm.StackRegister:
+		return v.Index(), true
+	}
+	return 0, false
+}
+
+// stackInstruction executes instructions which move values by their register arguments or by integers
+// on the stack, their signatures don't describe it, false for other instructions.
+func (a *analyzer) stackInstruction(instruction tasm.DeserializedInstruction, m *machine) bool {
+	args := instruction.Args()
+	// arg returns the printed value of the argument, raw removes the delta added by the decoder, e.g. for PUXC
+	arg := func(k int) int {
+		v, _ := integer(args[k])
+		return int(v)
+	}
+	raw := func(k int) int {
+		layout := instruction.Spec().Layout.Args[k]
+		if layout.Empty == spec.Delta {
+			return arg(k) - int(*layout.Delta)
+		}
+		return arg(k)
+	}
+	// dynamic pops the integer argument, the stack is unknown if it's not a constant
+	dynamic := func() (int, bool) {
+		v, ok := m.pop()
+		switch {
+		case !ok:
+		case v.t&Int == 0:
+			m.err = fmt.Errorf("argument is %s, expected Int", v.t)
+		case !v.known || v.constant < 0 || v.constant > 255:
+			m.forget()
+		default:
+			return int(v.constant), true
+		}
+		return 0, false
+	}
+
+	switch instruction.Name() {
+	case "XCHG_0I", "XCHG_0I_LONG":
+		m.xchg(0, arg(0))
+	case "XCHG_1I":
+		m.xchg(1, arg(len(args)-1))
+	case "XCHG_IJ":
+		m.xchg(arg(0), arg(1))
+	case "PUSH", "PUSH_LONG":
+		m.pushCopy(arg(0))
+	case "POP", "POP_LONG":
+		m.popTo(arg(0))
+	case "XCHG2":
+		m.xchg(1, arg(0))
+		m.xchg(0, arg(1))
+	case "XCHG3", "XCHG3_ALT":
+		m.xchg(2, arg(0))
+		m.xchg(1, arg(1))
+		m.xchg(0, arg(2))
+	case "XCPU":
+		m.xchg(0, arg(0))
+		m.pushCopy(arg(1))
+	case "PUXC":
+		m.pushCopy(arg(0))
+		m.xchg(0, 1)
+		m.xchg(0, raw(1))
+	case "PUSH2":
+		m.pushCopy(arg(0))
+		m.pushCopy(arg(1) + 1)
+	case "PUSH3":
+		m.pushCopy(arg(0))
+		m.pushCopy(arg(1) + 1)
+		m.pushCopy(arg(2) + 2)
+	case "XC2PU":
+		m.xchg(1, arg(0))
+		m.xchg(0, arg(1))
+		m.pushCopy(arg(2))
+	case "XCPUXC":
+		m.xchg(1, arg(0))
+		m.pushCopy(arg(1))
+		m.xchg(0, 1)
+		m.xchg(0, raw(2))
+	case "XCPU2":
+		m.xchg(0, arg(0))
+		m.pushCopy(arg(1))
+		m.pushCopy(arg(2) + 1)
+	case "PUXC2":
+		m.pushCopy(arg(0))
+		m.xchg(0, 2)
+		m.xchg(1, raw(1))
+		m.xchg(0, raw(2))
+	case "PUXCPU":
+		m.pushCopy(arg(0))
+		m.xchg(0, 1)
+		m.xchg(0, raw(1))
+		m.pushCopy(raw(2))
+	case "PU2XC":
+		m.pushCopy(arg(0))
+		m.xchg(0, 1)
+		m.pushCopy(raw(1))
+		m.xchg(0, 1)
+		m.xchg(0, raw(2))
+	case "BLKSWAP":
+		m.blkswap(arg(0), arg(1))
+	case "REVERSE":
+		m.reverse(arg(0), arg(1))
+	case "BLKPUSH":
+		for range arg(0) {
+			m.pushCopy(arg(1))
+		}
+	case "BLKDROP":
+		m.drop(arg(0))
+	case "BLKDROP2":
+		m.blkdrop2(arg(0), arg(1))
+	case "PICK":
+		if n, ok := dynamic(); ok {
+			m.pushCopy(n)
+		}
+	case "ROLL":
+		if n, ok := dynamic(); ok {
+			m.blkswap(1, n)
+		}
+	case "ROLLREV":
+		if n, ok := dynamic(); ok {
+			m.blkswap(n, 1)
+		}
+	case "BLKSWX", "REVX":
+		j, ok := dynamic()
+		if !ok {
+			break
+		}
+		i, ok := dynamic()
+		if !ok {
+			break
+		}
+		if instruction.Name() == "BLKSWX" {
+			m.blkswap(i, j)
+		} else {
+			m.reverse(i, j)
+		}
+	case "DROPX":
+		if n, ok := dynamic(); ok {
+			m.drop(n)
+		}
+	case "XCHGX":
+		if n, ok := dynamic(); ok {
+			m.xchg(0, n)
+		}
+	case "CHKDEPTH":
+		if n, ok := dynamic(); ok {
+			m.need(n)
+		}
+	case "ONLYTOPX":
+		if n, ok := dynamic(); ok {
+			m.onlyTop(n)
+		}
+	case "ONLYX":
+		if n, ok := dynamic(); ok {
+			m.only(n)
+		}
+	case "RUNVM":
+		// Pops a number of values depending on flags
+		m.forget()
+	default:
+		return false
+	}
+	return true
+}
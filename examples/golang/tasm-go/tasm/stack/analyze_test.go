@@ -0,0 +1,116 @@
+package stack
+
+import (
+	"reflect"
+	"tasm-go/spec"
+	"tasm-go/tasm"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// TestAnalyze checks the stack after the last instruction and the problems, the initial stack is closed and empty.
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+		problems []string
+	}{
+		{"PUSHINT_4 1 NEWC", "[Int Builder]", nil},
+		{"NEWC INC", "[Int]", []string{"INC: x is Builder, expected Int"}},
+		// The body of IF keeps the height, both paths have the same stack
+		{"PUSHINT_4 0 PUSHINT_4 1 PUSHCONT_SHORT { INC } IF", "[Int]", nil},
+		// The body of IF pushes a value, so the height depends on the condition
+		{"PUSHINT_4 1 PUSHCONT_SHORT { PUSHINT_4 2 } IF", "[?]", nil},
+		// Types of both branches of IFELSE are joined
+		{"PUSHINT_4 1 PUSHCONT_SHORT { PUSHINT_4 2 } PUSHCONT_SHORT { NEWC } IFELSE", "[Int|Builder]", nil},
+		{
+			"PUSHINT_4 1 PUSHCONT_SHORT { PUSHINT_4 2 } PUSHCONT_SHORT { DROP } IFELSE", "[?]",
+			[]string{"DROP: stack underflow: 1 values required, 0 available"},
+		},
+		// The body of REPEAT keeps the height, so the loop does too
+		{"PUSHINT_4 0 PUSHINT_4 3 PUSHCONT_SHORT { INC } REPEAT", "[Int]", nil},
+		// Each iteration pushes a value
+		{"PUSHINT_4 3 PUSHCONT_SHORT { PUSHINT_4 1 } REPEAT", "[?]", nil},
+		{
+			"PUSHINT_4 3 PUSHCONT_SHORT { INC } REPEAT", "[?]",
+			[]string{"INC: stack underflow: 1 values required, 0 available"},
+		},
+	}
+	for _, test := range tests {
+		code, err := tasm.Assemble(spec.Default(), test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		decompiled, err := tasm.DecompileCell(spec.Default(), code)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		result := Analyze(decompiled, WithInitialStack())
+		instructions := decompiled.Instructions()
+		if s, ok := result.After(instructions[len(instructions)-1]); !ok || s.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s %v", test.text, test.expected, s, ok)
+		}
+		var problems []string
+		for _, problem := range result.Problems {
+			problems = append(problems, problem.String())
+		}
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s: expected problems %q, got %q", test.text, test.problems, problems)
+		}
+	}
+}
+
+// TestAnalyzeOpenStack checks that values of the caller are taken from the open stack as inputs.
+func TestAnalyzeOpenStack(t *testing.T) {
+	code, err := tasm.Assemble(spec.Default(), "ADD NEWC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompiled, err := tasm.DecompileCell(spec.Default(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := Analyze(decompiled)
+	if len(result.Problems) != 0 {
+		t.Errorf("expected no problems, got %v", result.Problems)
+	}
+	s, ok := result.After(decompiled.Instructions()[1])
+	if expected := (State{Values: []Type{Int, Builder}, Inputs: 2, Open: true}); !ok || !reflect.DeepEqual(s, expected) || s.Height() != 0 {
+		t.Errorf("expected %+v of height 0, got %+v of height %d", expected, s, s.Height())
+	}
+}
+
+// TestAnalyzeSharedCells checks that cells referenced several times are analyzed again
+// only while the joined stack of the paths to them changes, and problems are reported once.
+func TestAnalyzeSharedCells(t *testing.T) {
+	const depth = 40
+	c := cell.BeginCell().MustStoreUInt(0xc8, 8).MustStoreUInt(0xa4, 8).EndCell() // NEWC INC
+	for range depth {
+		// IFREF next IFREF next, there are 2^depth paths to the first cell
+		c = cell.BeginCell().MustStoreUInt(0xe300, 16).MustStoreRef(c).MustStoreUInt(0xe300, 16).MustStoreRef(c).EndCell()
+	}
+	decompiled, err := tasm.DecompileCell(spec.Default(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := Analyze(decompiled)
+
+	var problems []string
+	for _, problem := range result.Problems {
+		problems = append(problems, problem.String())
+	}
+	if expected := []string{"INC: x is Builder, expected Int"}; !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected problems %q, got %q", expected, problems)
+	}
+	// Paths to the cell take different numbers of values of the caller
+	leaf := decompiled
+	for range depth {
+		leaf = leaf.Instructions()[0].Args()[0].(tasm.DecompiledCode)
+	}
+	if s, ok := result.After(leaf.Instructions()[1]); !ok || s.String() != "[? Int]" {
+		t.Errorf("expected [? Int] after INC, got %s %v", s, ok)
+	}
+}
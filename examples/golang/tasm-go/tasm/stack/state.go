@@ -0,0 +1,295 @@
+package stack
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"tasm-go/spec"
+)
+
+// Type is a set of possible types of a value.
+type Type uint8
+
+const (
+	Int Type = 1 << iota
+	Cell
+	Slice
+	Builder
+	Tuple
+	Continuation
+	Null
+	// Any value, including the types not listed above
+	Any Type = 1<<iota - 1
+)
+
+var typeNames = []string{"Int", "Cell", "Slice", "Builder", "Tuple", "Continuation", "Null"}
+
+// String formats the types as in signatures, e.g. `Cell|Null`.
+func (t Type) String() string {
+	switch t {
+	case Any:
+		return "Any"
+	case 0:
+		return "None"
+	}
+	var names []string
+	for i, name := range typeNames {
+		if t&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// typeOf converts types of a stack entry, Bool values are integers and missing types mean any value.
+func typeOf(types []spec.PossibleValueType) Type {
+	if len(types) == 0 {
+		return Any
+	}
+	var t Type
+	for _, name := range types {
+		switch name {
+		case spec.PossibleValueTypeInt, spec.Bool:
+			t |= Int
+		case spec.Cell:
+			t |= Cell
+		case spec.PossibleValueTypeSlice:
+			t |= Slice
+		case spec.Builder:
+			t |= Builder
+		case spec.Tuple:
+			t |= Tuple
+		case spec.PossibleValueTypeContinuation:
+			t |= Continuation
+		case spec.PossibleValueTypeNull:
+			t |= Null
+		default:
+			t |= Any
+		}
+	}
+	return t
+}
+
+// State is the inferred stack before or after an instruction.
+type State struct {
+	// Types of values from the bottom to the top of the stack
+	Values []Type
+	// Number of values taken from below the initial stack of the code, e.g. arguments of a method.
+	// They are the first Values, unless the code has popped them.
+	Inputs int
+	// Open stack may have more values below Values, e.g. the ones of the caller
+	Open bool
+	// Unknown is set when the height of the stack can't be inferred statically, e.g. after a call
+	// of an unknown continuation. Values are the ones pushed since then, the stack is open.
+	Unknown bool
+}
+
+// Height returns the number of values relative to the initial stack of the code, it's meaningless for Unknown stacks.
+func (s State) Height() int {
+	return len(s.Values) - s.Inputs
+}
+
+// String formats the stack with the top on the right, e.g. `[.. Int Slice]`,
+// where `..` denotes values of the caller and `?` values of unknown number.
+func (s State) String() string {
+	parts := make([]string, 0, len(s.Values)+1)
+	switch {
+	case s.Unknown:
+		parts = append(parts, "?")
+	case s.Open:
+		parts = append(parts, "..")
+	}
+	for _, t := range s.Values {
+		parts = append(parts, t.String())
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// value is a value on the stack, constants are tracked for stack instructions with
+// arguments on the stack, e.g. `2 PUSHINT ROLLX`.
+type value struct {
+	t        Type
+	constant int64
+	known    bool
+}
+
+// state is the stack during the analysis.
+type state struct {
+	values []value
+	inputs int
+	open   bool
+	lost   bool
+}
+
+func (s state) clone() state {
+	s.values = slices.Clone(s.values)
+	return s
+}
+
+// unknown returns the stack of unknown height.
+func unknown() state {
+	return state{open: true, lost: true}
+}
+
+// forget makes the height of the stack unknown, the following values are tracked as usual.
+func (s *state) forget() {
+	*s = unknown()
+}
+
+// equal reports whether the stacks have the same values, including the tracked constants.
+func (s state) equal(o state) bool {
+	return s.inputs == o.inputs && s.open == o.open && s.lost == o.lost && slices.Equal(s.values, o.values)
+}
+
+func (s state) export() State {
+	types := make([]Type, len(s.values))
+	for i, v := range s.values {
+		types[i] = v.t
+	}
+	return State{Values: types, Inputs: s.inputs, Open: s.open, Unknown: s.lost}
+}
+
+// join returns the stack after either of the paths. If heights differ, the height is unknown
+// and only the values on top of both stacks are kept.
+func join(a, b state) state {
+	if a.lost || b.lost || len(a.values)-a.inputs != len(b.values)-b.inputs {
+		n := min(len(a.values), len(b.values))
+		result := unknown()
+		for i := range n {
+			result.values = append(result.values, value{t: a.values[len(a.values)-n+i].t | b.values[len(b.values)-n+i].t})
+		}
+		return result
+	}
+	// Values taken from the caller on one path are untouched on the other one
+	for a.inputs < b.inputs {
+		a.values = slices.Insert(slices.Clone(a.values), 0, value{t: Any})
+		a.inputs++
+	}
+	for b.inputs < a.inputs {
+		b.values = slices.Insert(slices.Clone(b.values), 0, value{t: Any})
+		b.inputs++
+	}
+	result := state{values: make([]value, len(a.values)), inputs: a.inputs, open: a.open || b.open}
+	for i := range a.values {
+		result.values[i] = value{t: a.values[i].t | b.values[i].t}
+		if a.values[i].known && b.values[i].known && a.values[i].constant == b.values[i].constant {
+			result.values[i].constant, result.values[i].known = a.values[i].constant, true
+		}
+	}
+	return result
+}
+
+// machine executes stack operations, the first error stops it.
+type machine struct {
+	*state
+	err error
+}
+
+// need makes sure the stack has at least n values, taking values of the caller for open stacks.
+func (m *machine) need(n int) bool {
+	if m.err != nil {
+		return false
+	}
+	for len(m.values) < n {
+		if !m.open {
+			m.err = fmt.Errorf("stack underflow: %d values required, %d available", n, len(m.values))
+			return false
+		}
+		m.values = slices.Insert(m.values, 0, value{t: Any})
+		m.inputs++
+	}
+	return true
+}
+
+// at returns s(i), the top of the stack is s0.
+func (m *machine) at(i int) *value {
+	return &m.values[len(m.values)-1-i]
+}
+
+func (m *machine) push(v value) {
+	if m.err == nil {
+		m.values = append(m.values, v)
+	}
+}
+
+func (m *machine) pop() (value, bool) {
+	if !m.need(1) {
+		return value{t: Any}, false
+	}
+	v := *m.at(0)
+	m.values = m.values[:len(m.values)-1]
+	return v, true
+}
+
+// pushCopy is PUSH s(i).
+func (m *machine) pushCopy(i int) {
+	if m.need(i + 1) {
+		m.push(*m.at(i))
+	}
+}
+
+// popTo is POP s(i), it moves the top into s(i).
+func (m *machine) popTo(i int) {
+	if m.need(i + 1) {
+		*m.at(i) = *m.at(0)
+		m.values = m.values[:len(m.values)-1]
+	}
+}
+
+// xchg is XCHG s(i),s(j).
+func (m *machine) xchg(i, j int) {
+	if m.need(max(i, j) + 1) {
+		*m.at(i), *m.at(j) = *m.at(j), *m.at(i)
+	}
+}
+
+func (m *machine) drop(n int) {
+	if m.need(n) {
+		m.values = m.values[:len(m.values)-n]
+	}
+}
+
+// blkswap is BLKSWAP i,j, it swaps the blocks s(j+i-1)...s(j) and s(j-1)...s0.
+func (m *machine) blkswap(i, j int) {
+	if m.need(i + j) {
+		n := len(m.values)
+		swapped := append(slices.Clone(m.values[n-j:]), m.values[n-i-j:n-j]...)
+		copy(m.values[n-i-j:], swapped)
+	}
+}
+
+// reverse is REVERSE i,j, it reverses the order of s(j+i-1)...s(j).
+func (m *machine) reverse(i, j int) {
+	if m.need(i + j) {
+		n := len(m.values)
+		slices.Reverse(m.values[n-i-j : n-j])
+	}
+}
+
+// blkdrop2 is BLKDROP2 i,j, it drops i values under the top j ones.
+func (m *machine) blkdrop2(i, j int) {
+	if m.need(i + j) {
+		n := len(m.values)
+		m.values = slices.Delete(m.values, n-i-j, n-j)
+	}
+}
+
+// onlyTop is ONLYTOPX, it keeps the top n values and drops the rest of the stack.
+func (m *machine) onlyTop(n int) {
+	if m.need(n) {
+		m.values = m.values[len(m.values)-n:]
+		m.open = false
+	}
+}
+
+// only is ONLYX, it keeps the bottom n values.
+func (m *machine) only(n int) {
+	switch {
+	case m.err != nil:
+	case m.open:
+		// Values of the caller aren't known
+		m.forget()
+	case n < len(m.values):
+		m.values = m.values[:n]
+	}
+}
@@ -0,0 +1,206 @@
+// Package trace maps TVM execution logs onto the disassembled code.
+//
+// The TON emulator with the verbose VM log prints every step as
+//
+//	stack: [ 1 2 ]
+//	gas remaining: 999964
+//	code cell hash: 5A3F...E1 offset: 16
+//	execute ADD
+//
+// Steps are attributed to decoded instructions by the cell hash and the bit offset,
+// see tasm.Position, and the listing is annotated with execution counts and gas.
+package trace
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"tasm-go/tasm"
+)
+
+// Step is a single executed instruction of the log.
+type Step struct {
+	// Hash of the code cell and the bit offset of the instruction,
+	// empty for implicit jumps and returns, which have no location
+	CellHash []byte
+	Offset   uint
+	// Instruction as printed by TVM after `execute`, e.g. `ADD` or `implicit RET`
+	Instruction string
+	// Gas consumed by the step, -1 if unknown, e.g. for the last step
+	// or when the gas limit has been changed
+	Gas int64
+	// Line of the log with the instruction
+	Line int
+}
+
+var (
+	locationRe = regexp.MustCompile(`code cell hash: ([0-9A-Fa-f]+) offset: (\d+)`)
+	executeRe  = regexp.MustCompile(`execute (.+?)\s*$`)
+	gasRe      = regexp.MustCompile(`gas remaining: (-?\d+)`)
+)
+
+// Parse reads the steps of the VM log. Lines other than locations,
+// executed instructions and remaining gas are ignored.
+func Parse(r io.Reader) ([]Step, error) {
+	var steps []Step
+	// Remaining gas before each step, -1 if unknown
+	var remaining []int64
+
+	var location *Step
+	gas := int64(-1)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if m := gasRe.FindStringSubmatch(text); m != nil {
+			v, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			gas = v
+			continue
+		}
+		if m := locationRe.FindStringSubmatch(text); m != nil {
+			hash, err := hex.DecodeString(m[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid cell hash: %w", line, err)
+			}
+			offset, err := strconv.ParseUint(m[2], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			location = &Step{CellHash: hash, Offset: uint(offset)}
+			continue
+		}
+		if m := executeRe.FindStringSubmatch(text); m != nil {
+			step := Step{Instruction: m[1], Gas: -1, Line: line}
+			if location != nil {
+				step.CellHash, step.Offset = location.CellHash, location.Offset
+			}
+			steps = append(steps, step)
+			remaining = append(remaining, gas)
+			location, gas = nil, -1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Gas of a step is the difference of the remaining gas before it and before the next step
+	for i := 0; i+1 < len(steps); i++ {
+		if remaining[i] >= 0 && remaining[i+1] >= 0 && remaining[i] >= remaining[i+1] {
+			steps[i].Gas = remaining[i] - remaining[i+1]
+		}
+	}
+	return steps, nil
+}
+
+// Stat is the execution statistics of an instruction.
+type Stat struct {
+	// Number of executions
+	Count int
+	// Total gas of the executions with known gas
+	Gas int64
+}
+
+type location struct {
+	hash   string
+	offset uint
+}
+
+// Listing is the disassembled code with execution statistics of instructions.
+type Listing struct {
+	code  tasm.DecompiledCode
+	stats map[location]*Stat
+	// Steps which don't correspond to any decoded instruction,
+	// e.g. implicit jumps and returns or code loaded at runtime
+	Unmatched []Step
+	// Total number of steps and gas
+	Total Stat
+}
+
+// Annotate attributes the steps of the log to the decoded instructions.
+func Annotate(code tasm.DecompiledCode, steps []Step) *Listing {
+	l := &Listing{code: code, stats: make(map[location]*Stat)}
+	known := make(map[location]bool)
+	collectLocations(code.Instructions(), known, make(map[string]bool))
+
+	for _, step := range steps {
+		l.Total.Count++
+		if step.Gas > 0 {
+			l.Total.Gas += step.Gas
+		}
+		loc := location{hash: string(step.CellHash), offset: step.Offset}
+		if step.CellHash == nil || !known[loc] {
+			l.Unmatched = append(l.Unmatched, step)
+			continue
+		}
+		stat := l.stats[loc]
+		if stat == nil {
+			stat = &Stat{}
+			l.stats[loc] = stat
+		}
+		stat.Count++
+		if step.Gas > 0 {
+			stat.Gas += step.Gas
+		}
+	}
+	return l
+}
+
+// collectLocations finds locations of all instructions, including nested code and methods.
+// The code of a cell referenced several times is visited once.
+func collectLocations(instructions []tasm.DeserializedInstruction, known map[location]bool, visited map[string]bool) {
+	for _, instr := range instructions {
+		pos := instr.Position()
+		if instr.Name() != "ref" {
+			known[location{hash: string(pos.CellHash), offset: pos.Offset}] = true
+		}
+		for _, arg := range instr.Args() {
+			switch v := arg.(type) {
+			case tasm.DecompiledCode:
+				if hash := v.CellHash(); hash != nil {
+					if visited[string(hash)] {
+						continue
+					}
+					visited[string(hash)] = true
+				}
+				collectLocations(v.Instructions(), known, visited)
+			case tasm.DecompiledDict:
+				for _, method := range v.Methods() {
+					collectLocations(method.Instructions(), known, visited)
+				}
+			}
+		}
+	}
+}
+
+// Stat returns the statistics of the instruction, false if it has never been executed.
+func (l *Listing) Stat(instr tasm.DeserializedInstruction) (Stat, bool) {
+	pos := instr.Position()
+	stat, ok := l.stats[location{hash: string(pos.CellHash), offset: pos.Offset}]
+	if !ok || instr.Name() == "ref" {
+		return Stat{}, false
+	}
+	return *stat, true
+}
+
+// Format prints the code with `// exec N gas G` comments for executed instructions.
+// Instructions located in a cell shared by several places of the code have the same statistics.
+func (l *Listing) Format(opts ...tasm.PrintOption) string {
+	opts = append(opts, tasm.PrintComments(func(instr tasm.DeserializedInstruction) string {
+		stat, ok := l.Stat(instr)
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("exec %d gas %d", stat.Count, stat.Gas)
+	}))
+	return l.code.Format(opts...)
+}
+
+func (l *Listing) String() string {
+	return l.Format()
+}
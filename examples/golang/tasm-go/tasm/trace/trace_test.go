@@ -0,0 +1,116 @@
+package trace
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"tasm-go/spec"
+	"tasm-go/tasm"
+	"testing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// TestAnnotateSharedCells checks that the code of a cell referenced several times is walked once,
+// the tree of the code has 2^64 cells.
+func TestAnnotateSharedCells(t *testing.T) {
+	inc := cell.BeginCell().MustStoreUInt(0xa4, 8).EndCell()
+	c := inc
+	for range 64 {
+		c = cell.BeginCell().MustStoreUInt(0x88, 8).MustStoreRef(c).MustStoreRef(c).EndCell()
+	}
+	code, err := tasm.DecompileCell(spec.Default(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listing := Annotate(code, []Step{{CellHash: inc.Hash(), Offset: 0, Instruction: "INC", Gas: 18}})
+	if len(listing.Unmatched) != 0 {
+		t.Errorf("expected INC of the shared cell to be matched, got %v", listing.Unmatched)
+	}
+	if listing.Total != (Stat{Count: 1, Gas: 18}) {
+		t.Errorf("unexpected total %+v", listing.Total)
+	}
+}
+
+// TestParseAnnotate checks the steps of a VM log of `PUSHINT_4 2 PUSHCONT_SHORT { INC } REPEAT ref { DEC }`,
+// with implicit returns and jumps, and a step without remaining gas.
+func TestParseAnnotate(t *testing.T) {
+	log, err := os.Open("../../testdata/repeat_vm.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	steps, err := Parse(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := tasm.Assemble(spec.Default(), "PUSHINT_4 2 PUSHCONT_SHORT { INC } REPEAT ref { DEC }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Step{
+		{CellHash: root.Hash(), Offset: 0, Instruction: "PUSHINT 2", Gas: 18, Line: 5},
+		{CellHash: root.Hash(), Offset: 8, Instruction: "PUSHCONT x{A4}", Gas: 22, Line: 9},
+		{CellHash: root.Hash(), Offset: 24, Instruction: "REPEAT", Gas: 18, Line: 13},
+		{CellHash: root.Hash(), Offset: 16, Instruction: "INC", Gas: 18, Line: 17},
+		{Instruction: "implicit RET", Gas: 5, Line: 20},
+		// Gas isn't printed after the second INC, so both steps have unknown gas
+		{CellHash: root.Hash(), Offset: 16, Instruction: "INC", Gas: -1, Line: 24},
+		{Instruction: "implicit RET", Gas: -1, Line: 26},
+		{Instruction: "implicit JMPREF", Gas: 10, Line: 29},
+		{CellHash: root.MustPeekRef(0).Hash(), Offset: 0, Instruction: "DEC", Gas: 18, Line: 33},
+		// The last step has no next remaining gas
+		{Instruction: "implicit RET", Gas: -1, Line: 36},
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("expected %d steps, got %d: %v", len(expected), len(steps), steps)
+	}
+	for i, step := range steps {
+		if !reflect.DeepEqual(step, expected[i]) {
+			t.Errorf("step %d: expected %+v, got %+v", i, expected[i], step)
+		}
+	}
+
+	code, err := tasm.DecompileCell(spec.Default(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing := Annotate(code, steps)
+	if listing.Total != (Stat{Count: 10, Gas: 109}) {
+		t.Errorf("unexpected total %+v", listing.Total)
+	}
+	if len(listing.Unmatched) != 4 {
+		t.Errorf("expected 4 implicit steps to be unmatched, got %v", listing.Unmatched)
+	}
+
+	stats := map[string]Stat{}
+	var walk func(instructions []tasm.DeserializedInstruction)
+	walk = func(instructions []tasm.DeserializedInstruction) {
+		for _, instr := range instructions {
+			if stat, ok := listing.Stat(instr); ok {
+				stats[instr.Name()] = stat
+			}
+			for _, arg := range instr.Args() {
+				if nested, ok := arg.(tasm.DecompiledCode); ok {
+					walk(nested.Instructions())
+				}
+			}
+		}
+	}
+	walk(code.Instructions())
+	expectedStats := map[string]Stat{
+		"PUSHINT_4":      {Count: 1, Gas: 18},
+		"PUSHCONT_SHORT": {Count: 1, Gas: 22},
+		"REPEAT":         {Count: 1, Gas: 18},
+		"INC":            {Count: 2, Gas: 18},
+		"DEC":            {Count: 1, Gas: 18},
+	}
+	if !reflect.DeepEqual(stats, expectedStats) {
+		t.Errorf("expected statistics %v, got %v", expectedStats, stats)
+	}
+	if text := listing.String(); !strings.Contains(text, "    INC // exec 2 gas 18\n") {
+		t.Errorf("expected INC executed twice in\n%s", text)
+	}
+}
@@ -0,0 +1,100 @@
+package tasm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// VersionReport is the result of RequiredVersion.
+type VersionReport struct {
+	// Minimum TVM global version supporting all instructions of the code, zero if every version does
+	Version int64
+	// Instructions introduced after the first global version in the order of appearance,
+	// including nested code and methods of dictionaries
+	Instructions []DeserializedInstruction
+}
+
+// RequiredVersion returns the minimum TVM global version the code needs, according to
+// Layout.Version of its instructions. The code runs on the network if the global version
+// of its config is at least Version, see WithTVMVersion to decode code for the older ones.
+// Instructions of a cell referenced several times are listed once.
+func RequiredVersion(code DecompiledCode) VersionReport {
+	var report VersionReport
+	visited := make(map[string]bool)
+	var walk func(instructions []DeserializedInstruction)
+	walk = func(instructions []DeserializedInstruction) {
+		for _, instruction := range instructions {
+			if version := instruction.Version(); version > 0 {
+				report.Version = max(report.Version, version)
+				report.Instructions = append(report.Instructions, instruction)
+			}
+			for _, arg := range instruction.args {
+				switch v := arg.(type) {
+				case DecompiledCode:
+					if v.hash != nil {
+						if visited[string(v.hash)] {
+							continue
+						}
+						visited[string(v.hash)] = true
+					}
+					walk(v.instructions)
+				case DecompiledDict:
+					for _, method := range v.methods {
+						walk(method.instructions)
+					}
+				}
+			}
+		}
+	}
+	walk(code.instructions)
+	return report
+}
+
+// Supports reports whether the code runs on the TVM global version.
+func (r VersionReport) Supports(version int64) bool {
+	return r.Version <= version
+}
+
+// Unsupported returns the instructions which the TVM global version doesn't support.
+func (r VersionReport) Unsupported(version int64) []DeserializedInstruction {
+	return slices.DeleteFunc(slices.Clone(r.Instructions), func(instruction DeserializedInstruction) bool {
+		return instruction.Version() <= version
+	})
+}
+
+// String formats the report as `requires v6: GASCONSUMED (v4), GETPARAMLONG (v11)`,
+// instructions are listed once by name.
+func (r VersionReport) String() string {
+	if r.Version == 0 {
+		return "requires no specific version"
+	}
+	var names []string
+	for _, instruction := range r.Instructions {
+		name := fmt.Sprintf("%s (v%d)", instruction.name, instruction.Version())
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return fmt.Sprintf("requires v%d: %s", r.Version, strings.Join(names, ", "))
+}
+
+// Version returns the TVM global version which introduced the instruction,
+// zero for instructions of the first version and pseudo-instructions.
+func (d DeserializedInstruction) Version() int64 {
+	if d.instr == nil || d.instr.Layout.Version == nil {
+		return 0
+	}
+	return *d.instr.Layout.Version
+}
+
+// PrintRequiredVersions annotates instructions introduced in versions later than the given one
+// with the version they require, e.g. `// requires v4`. Zero annotates all versioned instructions.
+func PrintRequiredVersions(version int64) PrintOption {
+	return PrintComments(func(instruction DeserializedInstruction) string {
+		if v := instruction.Version(); v > version {
+			return fmt.Sprintf("requires v%d", v)
+		}
+		return ""
+	})
+}
@@ -0,0 +1,70 @@
+package tasm
+
+import (
+	"errors"
+	"strings"
+	"tasm-go/spec"
+	"testing"
+)
+
+// TestRequiredVersion checks the versions of instructions in nested code and methods,
+// and decoding for older TVM versions.
+func TestRequiredVersion(t *testing.T) {
+	code, err := Assemble(spec.Default(), "INC GASCONSUMED PUSHCONT_SHORT { GETGASFEE } DICTPUSHCONST 19 [ 0 => { GASCONSUMED } ]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompiled, err := DecompileCell(spec.Default(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := RequiredVersion(decompiled)
+	if report.Version != 6 || len(report.Instructions) != 3 {
+		t.Fatalf("expected v6 of 3 instructions, got %s", report)
+	}
+	if s := report.String(); s != "requires v6: GASCONSUMED (v4), GETGASFEE (v6)" {
+		t.Errorf("unexpected report %q", s)
+	}
+	if !report.Supports(6) || report.Supports(5) {
+		t.Error("expected v6 to be supported and v5 not")
+	}
+	if unsupported := report.Unsupported(4); len(unsupported) != 1 || unsupported[0].Name() != "GETGASFEE" {
+		t.Errorf("expected GETGASFEE unsupported by v4, got %v", unsupported)
+	}
+	if text := decompiled.Format(PrintRequiredVersions(4)); strings.Count(text, "// requires") != 1 ||
+		!strings.Contains(text, "GETGASFEE // requires v6") {
+		t.Errorf("expected GETGASFEE annotated for v4 in\n%s", text)
+	}
+
+	if report := RequiredVersion(DecompiledCode{}); report.Version != 0 || report.String() != "requires no specific version" {
+		t.Errorf("expected no version for empty code, got %s", report)
+	}
+
+	// GETGASFEE is an invalid opcode before v6
+	decoder, err := NewDecoder(spec.Default(), WithTVMVersion(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoder.DecompileCell(code); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected unsupported version, got %v", err)
+	}
+	lenient, err := NewDecoder(spec.Default(), WithTVMVersion(5), WithLenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompiled, err = lenient.DecompileCell(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := decompiled.String(); !strings.Contains(text, "UNKNOWN x{F836}") || !strings.Contains(text, "GASCONSUMED") {
+		t.Errorf("expected GETGASFEE as UNKNOWN and GASCONSUMED decoded for v5 in\n%s", text)
+	}
+	current, err := NewDecoder(spec.Default(), WithTVMVersion(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := current.DecompileCell(code); err != nil {
+		t.Errorf("expected the code decoded for v6, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package tasm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// ErrValueOutOfRange is returned when a value doesn't fit into the field of an instruction.
+var ErrValueOutOfRange = errors.New("value out of range")
+
+// writer wraps cell.Builder and remembers the first error, the counterpart of reader.
+// Unlike cell.Builder it checks that integers fit into the requested number of bits.
+type writer struct {
+	builder *cell.Builder
+	err     error
+}
+
+func (w *writer) uint(v *big.Int, bits uint) {
+	if w.err != nil {
+		return
+	}
+	if v.Sign() < 0 || v.BitLen() > int(bits) {
+		w.err = fmt.Errorf("%w: %s doesn't fit into %d-bit unsigned integer", ErrValueOutOfRange, v, bits)
+		return
+	}
+	w.store(v, bits)
+}
+
+func (w *writer) int(v *big.Int, bits uint) {
+	if w.err != nil {
+		return
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), bits)
+	if bits == 0 || v.Cmp(new(big.Int).Rsh(limit, 1)) >= 0 || v.Cmp(new(big.Int).Neg(new(big.Int).Rsh(limit, 1))) < 0 {
+		w.err = fmt.Errorf("%w: %s doesn't fit into %d-bit signed integer", ErrValueOutOfRange, v, bits)
+		return
+	}
+	if v.Sign() < 0 {
+		// Two's complement representation
+		v = new(big.Int).Add(v, limit)
+	}
+	w.store(v, bits)
+}
+
+// store writes non-negative v as a bits-long big-endian integer.
+func (w *writer) store(v *big.Int, bits uint) {
+	if bits == 0 {
+		return
+	}
+	length := (bits + 7) / 8
+	// Align data to the left, as cell.Builder expects
+	data := new(big.Int).Lsh(v, length*8-bits).FillBytes(make([]byte, length))
+	w.bits(data, bits)
+}
+
+func (w *writer) bits(data []byte, bits uint) {
+	if w.err != nil {
+		return
+	}
+	w.err = w.builder.StoreSlice(data, bits)
+}
+
+func (w *writer) ref(c *cell.Cell) {
+	if w.err != nil {
+		return
+	}
+	w.err = w.builder.StoreRef(c)
+}